@@ -24,12 +24,28 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/boards"
+	"github.com/gabeduke/wio-cli-go/pkg/compat"
+	"github.com/gabeduke/wio-cli-go/pkg/config"
+	"github.com/gabeduke/wio-cli-go/pkg/dashboard"
+	"github.com/gabeduke/wio-cli-go/pkg/device"
+	"github.com/gabeduke/wio-cli-go/pkg/doctor"
+	"github.com/gabeduke/wio-cli-go/pkg/drivers"
+	"github.com/gabeduke/wio-cli-go/pkg/fleet"
 	"github.com/gabeduke/wio-cli-go/pkg/nodes"
+	"github.com/gabeduke/wio-cli-go/pkg/schedule"
+	"github.com/gabeduke/wio-cli-go/pkg/shell"
 	"github.com/gabeduke/wio-cli-go/pkg/user"
+	"github.com/gabeduke/wio-cli-go/pkg/watch"
 	log "github.com/sirupsen/logrus"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -80,13 +96,25 @@ var rootCmd = &cobra.Command{
 The original Wio CLI was written in Python and can be found here: https://github.com/Seeed-Studio/wio-cli
 
 This CLI is a work in progress and is not yet feature complete. It is being developed by Gabriel Duke (gabeduke@gmail.com)
-The goal of this rewrite is to make the CLI more performant and easier to maintain.`,
+The goal of this rewrite is to make the CLI more performant and easier to maintain.
+
+Settings are taken from, in order of precedence:
+  1. command line flags, eg. --timeout
+  2. WIO_ environment variables, eg. WIO_SERVER, WIO_TOKEN, WIO_PROFILE
+  3. the active profile of the config file
+  4. the top level settings of the config file
+  5. defaults
+Run "wio config view" to see where each setting comes from.`,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Commands are cancelled on Ctrl-C through cmd.Context().
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -99,9 +127,21 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.wio.json)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.wio/config.json)")
 	rootCmd.PersistentFlags().VarP(&logLevel, "log-level", "l", `log level: "info", "debug", "warn", "error" (default is warn)`)
 	viper.BindPFlag("logLevel", rootCmd.PersistentFlags().Lookup("log-level"))
+	rootCmd.PersistentFlags().Duration(internal.TIMEOUT, 30*time.Second, "timeout of each API request")
+	viper.BindPFlag(internal.TIMEOUT, rootCmd.PersistentFlags().Lookup(internal.TIMEOUT))
+	rootCmd.PersistentFlags().Int(internal.RETRIES, 3, "retries of idempotent API requests on connection errors and 5xx responses")
+	viper.BindPFlag(internal.RETRIES, rootCmd.PersistentFlags().Lookup(internal.RETRIES))
+	rootCmd.PersistentFlags().Bool(internal.TRACE_HTTP, false, "print API requests and responses with tokens, node keys and passwords redacted")
+	viper.BindPFlag(internal.TRACE_HTTP, rootCmd.PersistentFlags().Lookup(internal.TRACE_HTTP))
+	rootCmd.PersistentFlags().String(internal.HAR, "", "record API requests and responses in a HAR file, with secrets redacted")
+	viper.BindPFlag(internal.HAR, rootCmd.PersistentFlags().Lookup(internal.HAR))
+	rootCmd.PersistentFlags().String(internal.PROFILE, "", "configuration profile to use, overriding the top level settings of the config file")
+	viper.BindPFlag(internal.PROFILE, rootCmd.PersistentFlags().Lookup(internal.PROFILE))
+	rootCmd.PersistentFlags().StringSlice(internal.RESOLVE, nil, "connect to host at ip instead of resolving it, as host:ip (repeatable)")
+	viper.BindPFlag(internal.RESOLVE, rootCmd.PersistentFlags().Lookup(internal.RESOLVE))
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -109,8 +149,33 @@ func init() {
 
 	rootCmd.AddCommand(user.NewUserCmd())
 	rootCmd.AddCommand(user.NewUserLoginCmd())
-	rootCmd.AddCommand(nodes.NewNodesCmd())
-	rootCmd.AddCommand(nodes.NewNodesListCmd())
+	rootCmd.AddCommand(nodesCmd())
+	if compat.Enabled() {
+		rootCmd.AddCommand(compat.NewListCmd())
+	} else {
+		listCmd := nodes.NewNodesListCmd()
+		compat.WrapList(listCmd)
+		rootCmd.AddCommand(listCmd)
+	}
+	rootCmd.AddCommand(schedule.NewScheduleCmd())
+	rootCmd.AddCommand(watch.NewWatchCmd())
+	rootCmd.AddCommand(shell.NewShellCmd())
+	rootCmd.AddCommand(dashboard.NewDashboardCmd())
+	rootCmd.AddCommand(drivers.NewDriversCmd())
+	rootCmd.AddCommand(boards.NewBoardsCmd())
+	rootCmd.AddCommand(fleet.NewPlanCmd())
+	rootCmd.AddCommand(fleet.NewApplyCmd())
+	rootCmd.AddCommand(doctor.NewDoctorCmd())
+	rootCmd.AddCommand(config.NewConfigCmd())
+	rootCmd.AddCommand(device.NewDeviceCmd())
+	rootCmd.AddCommand(compat.NewCompatCmds()...)
+}
+
+// nodesCmd returns the nodes command with the invocations of the Python CLI added.
+func nodesCmd() *cobra.Command {
+	cmd := nodes.NewNodesCmd()
+	compat.AddNodeCmds(cmd)
+	return cmd
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -135,14 +200,31 @@ func initConfig() {
 		viper.SetConfigName("config")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	internal.BindEnv() // read in the WIO_ environment variables of known settings
 
 	// If a config file is found, read it in.
 	err := viper.ReadInConfig()
-	if err != nil {
-		logErrorMessages = append(logErrorMessages, fmt.Sprintf("Error reading config file: %s", err))
+	var notFound viper.ConfigFileNotFoundError
+	if errors.As(err, &notFound) {
+		logDebugMessages = append(logDebugMessages, "No config file found")
+	} else if err != nil {
+		logErrorMessages = append(logErrorMessages, fmt.Sprintf("Error reading config file: %s (run `wio doctor` for details)", err))
+	} else if err := internal.CheckConfigFormat(viper.ConfigFileUsed()); err != nil {
+		logFatalMessages = append(logFatalMessages, err.Error())
 	} else {
 		logDebugMessages = append(logDebugMessages, fmt.Sprintf("Using config file: %s", viper.ConfigFileUsed()))
+
+		changes, err := internal.ApplyMigrations()
+		if err != nil {
+			logErrorMessages = append(logErrorMessages, fmt.Sprintf("Error reading config file: %s", err))
+		}
+		for _, change := range changes {
+			logDebugMessages = append(logDebugMessages, "Migrating config file: "+change)
+		}
+	}
+
+	if err := internal.ApplyProfile(); err != nil {
+		logFatalMessages = append(logFatalMessages, err.Error())
 	}
 
 	initLogger()
@@ -152,6 +234,10 @@ func initConfig() {
 		log.Infof(message)
 	}
 
+	for _, message := range logErrorMessages {
+		log.Error(message)
+	}
+
 	for _, message := range logFatalMessages {
 		log.Fatalf(message)
 	}
@@ -0,0 +1,251 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gofrs/flock"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lockTimeout bounds the wait for another wio process writing the configuration file or a state file next to
+// it, eg. during a batch provision.
+const lockTimeout = 10 * time.Second
+
+// ConfigFile returns the configuration file in use, or the default location when none was found.
+func ConfigFile() (string, error) {
+	if cfg := viper.ConfigFileUsed(); cfg != "" {
+		return cfg, nil
+	}
+
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// ReadConfig returns the settings of the configuration file migrated to the current version, without
+// flags, environment variables or profiles applied. A missing file has no settings.
+func ReadConfig() (map[string]interface{}, error) {
+	path, err := ConfigFile()
+	if err != nil {
+		return map[string]interface{}{}, err
+	}
+
+	settings, _, err := readConfig(path)
+	if err != nil {
+		return settings, err
+	}
+
+	_, _, err = Migrate(settings)
+	return settings, err
+}
+
+// CheckConfigFormat rejects a configuration file which is not JSON. Viper reads YAML or TOML as well, but the
+// migrations and the locked writes of the configuration file only handle JSON.
+func CheckConfigFormat(path string) error {
+	if ext := filepath.Ext(path); !strings.EqualFold(ext, ".json") {
+		return fmt.Errorf("the configuration file %s must be a JSON file with the .json extension", path)
+	}
+	return nil
+}
+
+// readConfig returns the settings of a configuration file as written and its content.
+func readConfig(path string) (map[string]interface{}, []byte, error) {
+	settings := map[string]interface{}{}
+	if err := CheckConfigFormat(path); err != nil {
+		return settings, nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil, nil
+	} else if err != nil {
+		return settings, nil, err
+	}
+
+	if len(data) > 0 {
+		err = json.Unmarshal(data, &settings)
+	}
+	return settings, data, err
+}
+
+// WriteConfig replaces the configuration file with settings, migrated to the current version.
+func WriteConfig(settings map[string]interface{}) error {
+	return EditConfig(func(current map[string]interface{}) error {
+		for k := range current {
+			delete(current, k)
+		}
+		for k, v := range settings {
+			current[k] = v
+		}
+		_, _, err := Migrate(current)
+		return err
+	})
+}
+
+// EditConfig changes the configuration file with fn while holding its lock, so concurrent invocations of
+// the CLI do not overwrite each other's changes. The settings passed to fn are migrated to the current
+// version and checked against Config before they are written; a file written by an older version is backed
+// up before it is replaced.
+func EditConfig(fn func(settings map[string]interface{}) error) error {
+	path, err := ConfigFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	unlock, err := LockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	settings, original, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+
+	from, _, err := Migrate(settings)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(settings); err != nil {
+		return err
+	}
+	settings[VERSION] = CONFIG_VERSION
+	if _, err := DecodeConfig(settings); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	if original != nil && from < CONFIG_VERSION {
+		if err := os.WriteFile(BackupFile(path, from), original, 0600); err != nil {
+			return fmt.Errorf("backing up the configuration file before migrating it: %v", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, append(data, '\n'), 0600)
+}
+
+// UpdateConfig sets a single key in the configuration file, nested keys are separated by dots, eg.
+// profiles.lab.mserver. A nil value removes the key. Unlike viper.WriteConfig it leaves the other keys of
+// the file untouched instead of writing every flag and default viper knows about.
+func UpdateConfig(key string, value interface{}) error {
+	return UpdateConfigValues(map[string]interface{}{key: value})
+}
+
+// UpdateConfigValues sets several keys like UpdateConfig in a single write.
+func UpdateConfigValues(values map[string]interface{}) error {
+	err := EditConfig(func(settings map[string]interface{}) error {
+		for key, value := range values {
+			setPath(settings, strings.Split(key, "."), value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, value := range values {
+		viper.Set(key, value)
+	}
+	return nil
+}
+
+// ProfileKey returns the key a setting is saved under: in the active profile when there is one, so
+// logging in with --profile lab stores the token of the lab server.
+func ProfileKey(key string) string {
+	if profile := viper.GetString(PROFILE); profile != "" {
+		return PROFILES + "." + profile + "." + key
+	}
+	return key
+}
+
+// BackupFile is the copy of a configuration file of version from, kept when it is migrated.
+func BackupFile(path string, from int) string {
+	return fmt.Sprintf("%s.v%d.bak", path, from)
+}
+
+// LockFile takes an exclusive lock on a file next to path, shared by every wio process. path itself can not
+// be locked since WriteFileAtomic replaces it on every write. The returned function releases the lock.
+func LockFile(path string) (func(), error) {
+	lock := flock.New(path + ".lock")
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockTimeout)
+	defer cancel()
+
+	locked, err := lock.TryLockContext(ctx, 50*time.Millisecond)
+	if err != nil && !locked {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s is locked by another wio process, giving up after %s", path, lockTimeout)
+		}
+		return nil, err
+	}
+
+	return func() { lock.Unlock() }, nil
+}
+
+// WriteFileAtomic writes data to a temporary file in the directory of path and renames it over path, so
+// readers see either the old or the new content and never a partial write.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// setPath sets or, with a nil value, deletes a nested key and prunes the maps left empty.
+func setPath(m map[string]interface{}, path []string, value interface{}) {
+	if len(path) == 1 {
+		if value == nil {
+			delete(m, path[0])
+		} else {
+			m[path[0]] = value
+		}
+		return
+	}
+
+	child, ok := m[path[0]].(map[string]interface{})
+	if !ok {
+		if value == nil {
+			return
+		}
+		child = map[string]interface{}{}
+		m[path[0]] = child
+	}
+
+	setPath(child, path[1:], value)
+	if len(child) == 0 {
+		delete(m, path[0])
+	}
+}
@@ -8,6 +8,30 @@ const (
 	NODE_SN       = "sn"
 	HOST_IP       = "mserver_ip"
 	EMAIL         = "email"
-	WIO_NODE_V1_0 = "Wio Node v1.0"
-	WIO_LINK_V1_0 = "Wio Link v1.0"
+)
+
+const (
+	TIMEOUT = "timeout" // timeout of each API request
+	RETRIES = "retries" // retries of idempotent API requests
+
+	TRACE_HTTP = "trace-http" // print the API traffic with the secrets redacted
+	HAR        = "har"        // record the API traffic in a HAR file
+)
+
+const (
+	PROFILE  = "profile"  // name of the active profile
+	PROFILES = "profiles" // settings of each profile, overriding the top level settings
+	ALIASES  = "aliases"  // short names of nodes, resolved to a node name or serial number
+
+	CA_BUNDLE            = "ca_bundle"            // PEM file of extra certificate authorities trusted for the server
+	CLIENT_CERT          = "client_cert"          // PEM client certificate for mutual TLS
+	CLIENT_KEY           = "client_key"           // PEM private key of the client certificate
+	INSECURE_SKIP_VERIFY = "insecure_skip_verify" // disable the verification of the server certificate
+	PROXY                = "proxy"                // http, https or socks5 proxy URL
+	RESOLVE              = "resolve"              // host:ip pairs dialed instead of resolving the host
+)
+
+const (
+	DEVICE_ADDR    = "device_addr"    // UDP address of the device in AP mode, NODE_UDP_ADDR by default
+	DEVICE_TIMEOUT = "device_timeout" // wait for the reply of the device in AP mode
 )
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"github.com/spf13/viper"
+	"os"
+	"strings"
+)
+
+// ENV_PREFIX namespaces the environment variables read by the CLI, so a TOKEN or KEY exported for another
+// tool in a CI job does not change its behavior.
+const ENV_PREFIX = "WIO"
+
+// envVars maps settings to the environment variables overriding them. Settings without an entry use
+// WIO_<SETTING> in upper case.
+var envVars = map[string]string{
+	HOST:       "WIO_SERVER",
+	HOST_IP:    "WIO_SERVER_IP",
+	"loglevel": "WIO_LOG_LEVEL",
+}
+
+var envReplacer = strings.NewReplacer("-", "_", ".", "_")
+
+// EnvSettings are the settings which can be overridden by an environment variable.
+var EnvSettings = []string{
+	HOST, HOST_IP, TOKEN, EMAIL, PROFILE,
+	CA_BUNDLE, CLIENT_CERT, CLIENT_KEY, INSECURE_SKIP_VERIFY, PROXY, RESOLVE,
+	TIMEOUT, RETRIES, TRACE_HTTP, HAR, "loglevel", DEVICE_ADDR, DEVICE_TIMEOUT,
+}
+
+// EnvVar returns the environment variable overriding a setting, eg. WIO_SERVER for mserver.
+func EnvVar(key string) string {
+	if env, ok := envVars[key]; ok {
+		return env
+	}
+	return ENV_PREFIX + "_" + strings.ToUpper(envReplacer.Replace(key))
+}
+
+// EnvSet reports whether the environment variable of a setting is set.
+func EnvSet(key string) bool {
+	_, ok := os.LookupEnv(EnvVar(key))
+	return ok
+}
+
+// BindEnv binds the WIO_ environment variables to their settings. Unlike viper.AutomaticEnv it only
+// reads the variables of known settings, so unrelated variables such as TOKEN or SN are ignored.
+func BindEnv() {
+	for _, key := range EnvSettings {
+		viper.BindEnv(key, EnvVar(key))
+	}
+}
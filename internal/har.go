@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The HAR 1.2 format, http://www.softwareishard.com/blog/har-12-spec/, restricted to the fields
+// the CLI records.
+type har struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type harRequest struct {
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	HTTPVersion string    `json:"httpVersion"`
+	Cookies     []harPair `json:"cookies"`
+	Headers     []harPair `json:"headers"`
+	QueryString []harPair `json:"queryString"`
+	PostData    *harPost  `json:"postData,omitempty"`
+	HeadersSize int       `json:"headersSize"`
+	BodySize    int       `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int        `json:"status"`
+	StatusText  string     `json:"statusText"`
+	HTTPVersion string     `json:"httpVersion"`
+	Cookies     []harPair  `json:"cookies"`
+	Headers     []harPair  `json:"headers"`
+	Content     harContent `json:"content"`
+	RedirectURL string     `json:"redirectURL"`
+	HeadersSize int        `json:"headersSize"`
+	BodySize    int        `json:"bodySize"`
+}
+
+type harPair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPost struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harFile collects the entries of a session. The file is rewritten after every request so the
+// session is saved even when the command exits on an error.
+type harFile struct {
+	mu   sync.Mutex
+	path string
+	har  har
+}
+
+func newHarFile(path string) *harFile {
+	return &harFile{path: path, har: har{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "wio-cli-go", Version: "1.0"},
+		Entries: []harEntry{},
+	}}}
+}
+
+func (f *harFile) add(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, reqErr error, start time.Time, elapsed time.Duration) {
+	if f == nil {
+		return
+	}
+	logger := CreateNamedLogger("http")
+
+	ms := float64(elapsed) / float64(time.Millisecond)
+	e := harEntry{
+		StartedDateTime: start,
+		Time:            ms,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         redactURL(req.URL),
+			HTTPVersion: req.Proto,
+			Cookies:     []harPair{},
+			Headers:     harHeaders(req.Header),
+			QueryString: []harPair{},
+			HeadersSize: -1,
+			BodySize:    len(reqBody),
+		},
+		Timings: harTimings{Wait: ms},
+	}
+	for k, values := range req.URL.Query() {
+		for _, v := range values {
+			if secretKeys[strings.ToLower(k)] {
+				v = redacted
+			}
+			e.Request.QueryString = append(e.Request.QueryString, harPair{Name: k, Value: v})
+		}
+	}
+	if len(reqBody) > 0 {
+		mime := req.Header.Get("Content-Type")
+		e.Request.PostData = &harPost{MimeType: mime, Text: redactBody(reqBody, mime)}
+	}
+
+	if resp != nil {
+		mime := resp.Header.Get("Content-Type")
+		e.Response = harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Cookies:     []harPair{},
+			Headers:     harHeaders(resp.Header),
+			Content:     harContent{Size: len(respBody), MimeType: mime, Text: redactBody(respBody, mime)},
+			HeadersSize: -1,
+			BodySize:    len(respBody),
+		}
+	} else {
+		// the request failed before a response was received
+		e.Response = harResponse{Cookies: []harPair{}, Headers: []harPair{}, HeadersSize: -1, BodySize: -1}
+		e.Comment = reqErr.Error()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.har.Log.Entries = append(f.har.Log.Entries, e)
+	data, err := json.MarshalIndent(f.har, "", "  ")
+	if err == nil {
+		err = os.WriteFile(f.path, data, 0600)
+	}
+	if err != nil {
+		logger.Warnf("Unable to write the HAR file: %v", err)
+	}
+}
+
+func harHeaders(h http.Header) []harPair {
+	pairs := []harPair{}
+	for name, values := range h {
+		for _, v := range values {
+			pairs = append(pairs, harPair{Name: name, Value: redactHeader(name, v)})
+		}
+	}
+	return pairs
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"github.com/spf13/viper"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	retryBase = 500 * time.Millisecond
+	retryMax  = 30 * time.Second
+)
+
+var (
+	client       *http.Client
+	clientErr    error
+	clientOnce   sync.Once
+	baseTrans    *http.Transport
+	baseTransErr error
+	transOnce    sync.Once
+)
+
+// transport returns the transport shared by the API client and the websocket dialer.
+func transport() (*http.Transport, error) {
+	transOnce.Do(func() {
+		baseTrans, baseTransErr = newTransport()
+	})
+	return baseTrans, baseTransErr
+}
+
+// HTTPClient returns the client shared by every API call. Its timeout, TLS, proxy and tracing settings
+// are read once from the flags and the configuration.
+func HTTPClient() (*http.Client, error) {
+	clientOnce.Do(func() {
+		var t *http.Transport
+		t, clientErr = transport()
+		if clientErr != nil {
+			return
+		}
+		client = &http.Client{Timeout: viper.GetDuration(TIMEOUT), Transport: t}
+
+		tr := &tracer{base: t, print: viper.GetBool(TRACE_HTTP)}
+		if path := viper.GetString(HAR); path != "" {
+			tr.har = newHarFile(path)
+		}
+		if tr.print || tr.har != nil {
+			client.Transport = tr
+		}
+	})
+	return client, clientErr
+}
+
+// Do sends an API request with the shared client. Idempotent requests are retried with an exponential
+// backoff and jitter on connection errors, 429 and 5xx responses, waiting for Retry-After when the server
+// sends it. The request is abandoned as soon as ctx is cancelled.
+func Do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	logger := CreateNamedLogger("http")
+	req = req.WithContext(ctx)
+
+	client, err := HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	retries := viper.GetInt(RETRIES)
+	if !idempotent(req) {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := client.Do(req)
+		if ctx.Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		if attempt >= retries || !retryable(resp, err) {
+			return resp, err
+		}
+
+		wait := backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				wait = after
+			}
+			logger.WithField("status", resp.Status).WithField("url", req.URL.Redacted()).Debugf("retrying in %s", wait)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			logger.WithError(err).WithField("url", req.URL.Redacted()).Debugf("retrying in %s", wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return req.Body == nil || req.GetBody != nil
+	}
+	return false
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var netErr net.Error
+		return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// backoff returns a random delay up to retryBase * 2^attempt, capped at retryMax.
+func backoff(attempt int) time.Duration {
+	d := retryBase << attempt
+	if d <= 0 || d > retryMax {
+		d = retryMax
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	if s, err := strconv.Atoi(v); err == nil {
+		return clampDelay(time.Duration(s) * time.Second), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return clampDelay(time.Until(t)), true
+	}
+	return 0, false
+}
+
+func clampDelay(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	if d > retryMax {
+		return retryMax
+	}
+	return d
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Config is the layout of the configuration file, described for editors by the JSON Schema of the config
+// command. EditConfig decodes every write into it so a setting of the wrong type never reaches the file.
+type Config struct {
+	Schema        string `json:"$schema,omitempty"`
+	Version       int    `json:"version"`
+	Profile       string `json:"profile,omitempty"`
+	LogLevel      string `json:"loglevel,omitempty"`
+	DeviceAddr    string `json:"device_addr,omitempty"`
+	DeviceTimeout string `json:"device_timeout,omitempty"`
+	Settings
+	Profiles map[string]Settings          `json:"profiles,omitempty"`
+	Aliases  map[string]string            `json:"aliases,omitempty"`
+	Labels   map[string]map[string]string `json:"labels,omitempty"`
+	Watch    map[string]interface{}       `json:"watch,omitempty"`
+}
+
+// Settings can be set at the top level of the configuration file and in each profile.
+type Settings struct {
+	Server             string   `json:"mserver,omitempty"`
+	ServerIP           string   `json:"mserver_ip,omitempty"`
+	Token              string   `json:"token,omitempty"`
+	Email              string   `json:"email,omitempty"`
+	CABundle           string   `json:"ca_bundle,omitempty"`
+	ClientCert         string   `json:"client_cert,omitempty"`
+	ClientKey          string   `json:"client_key,omitempty"`
+	InsecureSkipVerify bool     `json:"insecure_skip_verify,omitempty"`
+	Proxy              string   `json:"proxy,omitempty"`
+	Resolve            []string `json:"resolve,omitempty"`
+	Timeout            string   `json:"timeout,omitempty"`
+	Retries            *int     `json:"retries,omitempty"`
+}
+
+// DecodeConfig converts the settings of a configuration file to a Config, checking the type of each known
+// key. Unknown keys are ignored.
+func DecodeConfig(settings map[string]interface{}) (*Config, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var c Config
+	err = json.NewDecoder(bytes.NewReader(data)).Decode(&c)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return nil, fmt.Errorf("%s must be of type %s, not %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+	return &c, err
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NormalizeLegacyConfig adapts a configuration file written by the Python wio-cli, which shares the
+// ~/.wio/config.json location and key names:
+//   - it creates the file with empty "email" and "token" placeholders, which are removed so they do not
+//     hide a profile or read as a configured empty token;
+//   - the server address may lack a scheme or end with a slash, it is read as https://<host>.
+//
+// Only top level keys are changed since the Python CLI has no profiles. It is the first step of the
+// migration from version 1, and the changes are returned so they can be logged.
+func NormalizeLegacyConfig(settings map[string]interface{}) []string {
+	var changes []string
+
+	for _, key := range sortedSettings(settings) {
+		if s, ok := settings[key].(string); ok && strings.TrimSpace(s) == "" {
+			delete(settings, key)
+			changes = append(changes, fmt.Sprintf("ignoring empty %s", key))
+		}
+	}
+
+	if server, ok := settings[HOST].(string); ok {
+		normalized := strings.TrimRight(strings.TrimSpace(server), "/")
+		if !strings.Contains(normalized, "://") {
+			normalized = "https://" + normalized
+		}
+		if normalized != server {
+			settings[HOST] = normalized
+			changes = append(changes, fmt.Sprintf("reading %s %q as %q", HOST, server, normalized))
+		}
+	}
+
+	return changes
+}
+
+func sortedSettings[V any](settings map[string]V) []string {
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
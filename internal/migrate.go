@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+)
+
+const (
+	VERSION        = "version" // version of the configuration file layout
+	CONFIG_VERSION = 2         // version written by this CLI
+)
+
+// migration upgrades the settings of a configuration file from version to version+1 in place and
+// describes what it changed.
+type migration func(settings map[string]interface{}) []string
+
+// migrations are indexed by the version they upgrade from, starting at version 1.
+var migrations = map[int]migration{
+	1: migrateV1,
+}
+
+// ConfigVersion returns the layout version of settings. Files written before the version field was
+// introduced, including those of the Python CLI, are version 1.
+func ConfigVersion(settings map[string]interface{}) (int, error) {
+	v, ok := settings[VERSION]
+	if !ok {
+		return 1, nil
+	}
+
+	switch n := v.(type) {
+	case float64:
+		if n == float64(int(n)) && n >= 1 {
+			return int(n), nil
+		}
+	case int:
+		if n >= 1 {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid %s %v in the configuration file, expected a positive integer", VERSION, v)
+}
+
+// Migrate upgrades settings in place to CONFIG_VERSION. It returns the version the settings had and the
+// changes made. Settings written by a newer CLI are not changed, they are an error since they may hold
+// settings this version does not understand.
+func Migrate(settings map[string]interface{}) (from int, changes []string, err error) {
+	from, err = ConfigVersion(settings)
+	if err != nil {
+		return from, nil, err
+	}
+	if from > CONFIG_VERSION {
+		return from, nil, fmt.Errorf("the configuration file is version %d but this wio only supports up to version %d, upgrade wio", from, CONFIG_VERSION)
+	}
+
+	for v := from; v < CONFIG_VERSION; v++ {
+		for _, c := range migrations[v](settings) {
+			changes = append(changes, fmt.Sprintf("v%d: %s", v, c))
+		}
+		settings[VERSION] = v + 1
+	}
+	return from, changes, nil
+}
+
+// ApplyMigrations reloads the configuration file read by viper with the migrations applied. The file
+// itself is left untouched, so the Python CLI keeps working with it; it is rewritten in the current layout,
+// after a backup, the next time a setting is saved or with `wio config migrate`.
+func ApplyMigrations() ([]string, error) {
+	if viper.ConfigFileUsed() == "" {
+		return nil, nil
+	}
+
+	settings, _, err := readConfig(viper.ConfigFileUsed())
+	if err != nil {
+		return nil, err
+	}
+
+	_, changes, err := Migrate(settings)
+	if err != nil || len(changes) == 0 {
+		return changes, err
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	viper.SetConfigType("json")
+	return changes, viper.ReadConfig(bytes.NewReader(data))
+}
+
+// flagDefaults are the flags viper.WriteConfig used to save with their default value when logging in.
+var flagDefaults = map[string]interface{}{
+	TIMEOUT:    "30s",
+	RETRIES:    float64(3),
+	TRACE_HTTP: false,
+	"create":   false,
+}
+
+// flagOnly are flags of single commands which viper.WriteConfig saved although they are not settings.
+var flagOnly = []string{HAR, NODE_KEY, NODE_SN, "name", "board"}
+
+// migrateV1 adapts the layout of the Python CLI with NormalizeLegacyConfig and removes the flags which
+// `wio user login` and `wio user configure` saved along with the token.
+func migrateV1(settings map[string]interface{}) []string {
+	changes := NormalizeLegacyConfig(settings)
+
+	for _, key := range sortedSettings(flagDefaults) {
+		if v, ok := settings[key]; ok && v == flagDefaults[key] {
+			delete(settings, key)
+			changes = append(changes, fmt.Sprintf("removing %s, saved with its default value", key))
+		}
+	}
+
+	for _, key := range flagOnly {
+		if _, ok := settings[key]; ok {
+			delete(settings, key)
+			changes = append(changes, fmt.Sprintf("removing %s, a command flag rather than a setting", key))
+		}
+	}
+
+	if l, ok := settings[RESOLVE].([]interface{}); ok && len(l) == 0 {
+		delete(settings, RESOLVE)
+		changes = append(changes, fmt.Sprintf("removing the empty %s", RESOLVE))
+	}
+
+	return changes
+}
+
+// MigrateConfig rewrites the configuration file in the current layout, backing up the old file. It returns
+// the version the file had and the changes made, and does nothing when the file is already current.
+func MigrateConfig() (from int, changes []string, err error) {
+	path, err := ConfigFile()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	settings, original, err := readConfig(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	if original == nil {
+		return CONFIG_VERSION, nil, nil
+	}
+
+	from, changes, err = Migrate(settings)
+	if err != nil || from == CONFIG_VERSION {
+		return from, changes, err
+	}
+
+	return from, changes, EditConfig(func(map[string]interface{}) error { return nil })
+}
@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	settings := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &settings); err != nil {
+		t.Fatal(err)
+	}
+	return settings
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		want     string
+		from     int
+		changes  int
+		err      string
+	}{
+		{
+			name:     "python layout",
+			settings: `{"email": "", "token": "", "mserver": "us.wio.seeed.io/", "mserver_ip": "54.223.12.10"}`,
+			want:     `{"mserver": "https://us.wio.seeed.io", "mserver_ip": "54.223.12.10", "version": 2}`,
+			from:     1,
+			changes:  3,
+		},
+		{
+			name:     "python layout with a scheme",
+			settings: `{"email": "me@example.com", "token": "t", "mserver": "https://cn.wio.seeed.io"}`,
+			want:     `{"email": "me@example.com", "token": "t", "mserver": "https://cn.wio.seeed.io", "version": 2}`,
+			from:     1,
+		},
+		{
+			name: "flags saved by viper.WriteConfig",
+			settings: `{"mserver": "https://us.wio.seeed.io", "token": "t", "timeout": "30s", "retries": 3, "trace-http": false,
+				"create": false, "har": "", "key": "k", "sn": "s", "name": "n", "board": "link", "resolve": []}`,
+			want:    `{"mserver": "https://us.wio.seeed.io", "token": "t", "version": 2}`,
+			from:    1,
+			changes: 10,
+		},
+		{
+			name:     "settings changed from their default are kept",
+			settings: `{"timeout": "10s", "retries": 5, "trace-http": true, "resolve": ["us.wio.seeed.io:10.0.0.1"]}`,
+			want:     `{"timeout": "10s", "retries": 5, "trace-http": true, "resolve": ["us.wio.seeed.io:10.0.0.1"], "version": 2}`,
+			from:     1,
+		},
+		{
+			name:     "current version",
+			settings: `{"version": 2, "mserver": "us.wio.seeed.io", "email": ""}`,
+			want:     `{"version": 2, "mserver": "us.wio.seeed.io", "email": ""}`,
+			from:     2,
+		},
+		{
+			name:     "newer version",
+			settings: `{"version": 3}`,
+			err:      "upgrade wio",
+		},
+		{
+			name:     "invalid version",
+			settings: `{"version": "two"}`,
+			err:      "invalid version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := decode(t, tt.settings)
+			from, changes, err := Migrate(settings)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if from != tt.from {
+				t.Errorf("migrated from version %d, want %d", from, tt.from)
+			}
+			if len(changes) != tt.changes {
+				t.Errorf("got %d changes, want %d: %q", len(changes), tt.changes, changes)
+			}
+
+			// compared as JSON, the version is an int after a migration and a float64 when read
+			got, _ := json.Marshal(settings)
+			if !reflect.DeepEqual(decode(t, string(got)), decode(t, tt.want)) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	original := []byte(`{"email": "", "token": "t", "mserver": "us.wio.seeed.io"}`)
+	if err := os.WriteFile(path, original, 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(path)
+	t.Cleanup(viper.Reset)
+
+	from, changes, err := MigrateConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 1 || len(changes) != 2 {
+		t.Fatalf("migrated from version %d with %q", from, changes)
+	}
+
+	backup, err := os.ReadFile(BackupFile(path, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(backup, original) {
+		t.Fatalf("the backup holds %s", backup)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decode(t, `{"token": "t", "mserver": "https://us.wio.seeed.io", "version": 2}`)
+	if got := decode(t, string(data)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("the file holds %s", data)
+	}
+
+	// a current file is left alone
+	from, changes, err = MigrateConfig()
+	if err != nil || from != CONFIG_VERSION || len(changes) != 0 {
+		t.Fatalf("second migration: version %d, changes %q, error %v", from, changes, err)
+	}
+}
+
+func TestCheckConfigFormat(t *testing.T) {
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"/home/me/.wio/config.json", true},
+		{"/home/me/.wio/CONFIG.JSON", true},
+		{"/home/me/.wio/config.yaml", false},
+		{"/home/me/.wio/config.toml", false},
+		{"/home/me/.wio/config", false},
+	}
+	for _, tt := range tests {
+		if err := CheckConfigFormat(tt.path); (err == nil) != tt.ok {
+			t.Errorf("CheckConfigFormat(%q) = %v", tt.path, err)
+		}
+	}
+
+	// the locked writes refuse to turn a YAML file into JSON
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("token: t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(path)
+	t.Cleanup(viper.Reset)
+
+	if err := UpdateConfig(TOKEN, "other"); err == nil {
+		t.Fatal("a YAML configuration file was rewritten")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "token: t\n" {
+		t.Fatalf("the file holds %q", data)
+	}
+}
@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"sort"
+)
+
+// ApplyProfile merges the settings of the active profile over the top level settings of the
+// configuration file. Flags and environment variables still take precedence over them.
+func ApplyProfile() error {
+	name := viper.GetString(PROFILE)
+	if name == "" {
+		return nil
+	}
+
+	if !viper.IsSet(PROFILES + "." + name) {
+		return fmt.Errorf("profile %q not found, the configured profiles are %v", name, Profiles())
+	}
+
+	return viper.MergeConfigMap(viper.GetStringMap(PROFILES + "." + name))
+}
+
+// Profiles lists the names of the configured profiles.
+func Profiles() []string {
+	var names []string
+	for name := range viper.GetStringMap(PROFILES) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
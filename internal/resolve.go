@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/viper"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pinnedHosts maps host names to the IP address the API client dials instead of resolving them:
+// the mserver host to mserver_ip, overridden by the --resolve entries.
+func pinnedHosts() (map[string]string, error) {
+	pinned := map[string]string{}
+
+	if ip := viper.GetString(HOST_IP); ip != "" {
+		u, err := url.Parse(viper.GetString(HOST))
+		if err == nil && u.Hostname() != "" && net.ParseIP(u.Hostname()) == nil {
+			if net.ParseIP(ip) == nil {
+				return nil, fmt.Errorf("invalid %s %q, expected an IP address", HOST_IP, ip)
+			}
+			pinned[strings.ToLower(u.Hostname())] = ip
+		}
+	}
+
+	var entries []string
+	for _, entry := range viper.GetStringSlice(RESOLVE) {
+		// WIO_RESOLVE holds the pairs separated by commas
+		entries = append(entries, strings.Split(entry, ",")...)
+	}
+
+	for _, entry := range entries {
+		host, ip, ok := strings.Cut(entry, ":")
+		if !ok || host == "" || net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid --%s %q, expected host:ip", RESOLVE, entry)
+		}
+		pinned[strings.ToLower(host)] = ip
+	}
+
+	return pinned, nil
+}
+
+// pinnedDialer dials the pinned IP of a host instead of resolving it. Only the TCP connection is
+// redirected, TLS still verifies the certificate for the host name and sends it as SNI and Host.
+type pinnedDialer struct {
+	dialer  *net.Dialer
+	pinned  map[string]string
+	checked sync.Map
+}
+
+func (d *pinnedDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+
+	ip, ok := d.pinned[strings.ToLower(host)]
+	if !ok {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+
+	if _, done := d.checked.LoadOrStore(host, true); !done {
+		checkPinnedIP(ctx, host, ip)
+	}
+
+	CreateNamedLogger("http").Debugf("Dialing %s at pinned address %s", host, ip)
+	return d.dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+}
+
+// checkPinnedIP warns when DNS no longer returns the pinned address of a host, eg. after the server
+// moved. DNS failures are expected when the address is pinned and only logged at debug level.
+func checkPinnedIP(ctx context.Context, host, ip string) {
+	logger := CreateNamedLogger("http")
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		logger.Debugf("Unable to check the pinned address of %s: %v", host, err)
+		return
+	}
+
+	for _, a := range addrs {
+		if net.ParseIP(a).Equal(net.ParseIP(ip)) {
+			return
+		}
+	}
+	logger.Warnf("%s is pinned to %s but DNS resolves it to %s, update %s or --%s if the server moved",
+		host, ip, strings.Join(addrs, ", "), HOST_IP, RESOLVE)
+}
+
+// PinnedIP returns the address host is pinned to with mserver_ip or --resolve.
+func PinnedIP(host string) (string, bool, error) {
+	pinned, err := pinnedHosts()
+	if err != nil {
+		return "", false, err
+	}
+	ip, ok := pinned[strings.ToLower(host)]
+	return ip, ok, nil
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const redacted = "REDACTED"
+
+// secretKeys are the header, query, form and JSON field names whose values are never traced.
+var secretKeys = map[string]bool{
+	"authorization": true,
+	"password":      true,
+	"token":         true,
+	"access_token":  true,
+	"node_key":      true,
+	"key":           true,
+}
+
+// tracer is a RoundTripper which prints the traffic to stderr with --trace-http and records it
+// in a HAR file with --har. Secrets are redacted in both.
+type tracer struct {
+	base  http.RoundTripper
+	print bool
+	har   *harFile
+}
+
+func (t *tracer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+
+	if t.print {
+		fmt.Fprintf(os.Stderr, "> %s %s\n", req.Method, redactURL(req.URL))
+		printHeaders(">", req.Header)
+		printBody(">", reqBody, req.Header.Get("Content-Type"))
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	elapsed := time.Since(start)
+	if err != nil {
+		if t.print {
+			fmt.Fprintf(os.Stderr, "< %v (%s)\n\n", err, elapsed.Round(time.Millisecond))
+		}
+		t.har.add(req, reqBody, nil, nil, err, start, elapsed)
+		return resp, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.har.add(req, reqBody, nil, nil, err, start, elapsed)
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	if t.print {
+		fmt.Fprintf(os.Stderr, "< %s (%s)\n", resp.Status, elapsed.Round(time.Millisecond))
+		printHeaders("<", resp.Header)
+		printBody("<", respBody, resp.Header.Get("Content-Type"))
+		fmt.Fprintln(os.Stderr)
+	}
+	t.har.add(req, reqBody, resp, respBody, nil, start, elapsed)
+
+	return resp, nil
+}
+
+func printHeaders(prefix string, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, v := range h[name] {
+			fmt.Fprintf(os.Stderr, "%s %s: %s\n", prefix, name, redactHeader(name, v))
+		}
+	}
+}
+
+func printBody(prefix string, body []byte, contentType string) {
+	if len(body) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s\n%s\n", prefix, redactBody(body, contentType))
+}
+
+func redactHeader(name, value string) string {
+	if !secretKeys[strings.ToLower(name)] {
+		return value
+	}
+	// keep the scheme, eg. "token REDACTED"
+	if i := strings.Index(value, " "); i > 0 {
+		return value[:i+1] + redacted
+	}
+	return redacted
+}
+
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	for k := range q {
+		if secretKeys[strings.ToLower(k)] {
+			q.Set(k, redacted)
+		}
+	}
+
+	c := *u
+	c.RawQuery = q.Encode()
+	return c.Redacted()
+}
+
+// redactBody masks the secrets of a JSON or form encoded body. Other bodies are returned unchanged.
+func redactBody(body []byte, contentType string) string {
+	if strings.Contains(contentType, "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+		if err == nil {
+			for k := range form {
+				if secretKeys[strings.ToLower(k)] {
+					form.Set(k, redacted)
+				}
+			}
+			return form.Encode()
+		}
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err == nil {
+		data, err := json.Marshal(Redact(v))
+		if err == nil {
+			return string(data)
+		}
+	}
+
+	return string(body)
+}
+
+// Redact masks the secret fields of a decoded JSON document or of the viper settings in place.
+func Redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if secretKeys[strings.ToLower(k)] {
+				v[k] = redacted
+			} else {
+				v[k] = Redact(val)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = Redact(v[i])
+		}
+	}
+	return v
+}
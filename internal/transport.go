@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// newTransport builds the transport of the API client from the TLS and proxy settings of the active
+// profile. Without settings it behaves like http.DefaultTransport.
+func newTransport() (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	pinned, err := pinnedHosts()
+	if err != nil {
+		return nil, err
+	}
+	if len(pinned) > 0 {
+		d := &pinnedDialer{dialer: &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}, pinned: pinned}
+		t.DialContext = d.DialContext
+	}
+
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	t.TLSClientConfig = tlsConfig
+
+	if p := viper.GetString(PROXY); p != "" {
+		u, err := url.Parse(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", PROXY, p, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported %s scheme %q, use http, https or socks5", PROXY, u.Scheme)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	return t, nil
+}
+
+func newTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{}
+
+	if path := viper.GetString(CA_BUNDLE); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", CA_BUNDLE, err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s %s", CA_BUNDLE, path)
+		}
+		config.RootCAs = pool
+	}
+
+	cert, key := viper.GetString(CLIENT_CERT), viper.GetString(CLIENT_KEY)
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return nil, fmt.Errorf("%s and %s must be set together", CLIENT_CERT, CLIENT_KEY)
+		}
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("loading the client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	if viper.GetBool(INSECURE_SKIP_VERIFY) {
+		CreateNamedLogger("http").Warnf("!!! TLS certificate verification is disabled (%s), the connection to %s can be intercepted !!!",
+			INSECURE_SKIP_VERIFY, viper.GetString(HOST))
+		config.InsecureSkipVerify = true
+	}
+
+	return config, nil
+}
+
+// WebsocketDialer returns a websocket dialer using the TLS and proxy settings of the API client.
+func WebsocketDialer() (*websocket.Dialer, error) {
+	t, err := transport()
+	if err != nil {
+		return nil, err
+	}
+
+	return &websocket.Dialer{
+		NetDialContext:   t.DialContext,
+		Proxy:            t.Proxy,
+		TLSClientConfig:  t.TLSClientConfig,
+		HandshakeTimeout: viper.GetDuration(TIMEOUT),
+	}, nil
+}
+
+// TLSConfig returns a copy of the TLS settings of the API client.
+func TLSConfig() (*tls.Config, error) {
+	t, err := transport()
+	if err != nil {
+		return nil, err
+	}
+	return t.TLSClientConfig.Clone(), nil
+}
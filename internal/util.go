@@ -3,6 +3,9 @@ package internal
 import (
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
 )
 
 func CreateNamedLogger(module ...string) *logrus.Entry {
@@ -23,3 +26,20 @@ func Prompt(prompt, fallback string) string {
 	fmt.Scanln(&input)
 	return input
 }
+
+// ConfigDir returns the directory holding the configuration file and the
+// state files written by the CLI, creating it if it does not exist yet.
+func ConfigDir() (string, error) {
+	var dir string
+	if cfg := viper.ConfigFileUsed(); cfg != "" {
+		dir = filepath.Dir(cfg)
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".wio")
+	}
+
+	return dir, os.MkdirAll(dir, 0700)
+}
@@ -0,0 +1,189 @@
+package boards
+
+import (
+	_ "embed"
+	"fmt"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed boards.yaml
+var builtin []byte
+
+// Board describes a Wio board and the Grove ports it exposes.
+type Board struct {
+	// ID is the short name used on the command line, eg. link
+	ID string `json:"id" yaml:"id"`
+	// Name is the display name, eg. Wio Link
+	Name string `json:"name" yaml:"name"`
+	// ServerID is the board identifier used by the server API, eg. Wio Link v1.0
+	ServerID string `json:"server_id" yaml:"server_id"`
+	Ports    []Port `json:"ports" yaml:"ports"`
+}
+
+// Port is a Grove port of a board. Ports sharing a connector can not be used at the same time.
+type Port struct {
+	Name       string   `json:"name" yaml:"name"`
+	Connector  string   `json:"connector,omitempty" yaml:"connector,omitempty"`
+	Interfaces []string `json:"interfaces" yaml:"interfaces"`
+}
+
+// Supports reports whether the port can be used with the interface type, eg. I2C.
+func (p Port) Supports(iface string) bool {
+	for _, i := range p.Interfaces {
+		if strings.EqualFold(i, iface) {
+			return true
+		}
+	}
+	return false
+}
+
+// Port returns the port with the given name.
+func (b Board) Port(name string) (Port, bool) {
+	for _, p := range b.Ports {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return Port{}, false
+}
+
+// PortsFor returns the names of the ports supporting the interface type.
+func (b Board) PortsFor(iface string) []string {
+	var names []string
+	for _, p := range b.Ports {
+		if p.Supports(iface) {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+type file struct {
+	Boards []Board `json:"boards" yaml:"boards"`
+}
+
+// Registry holds the known boards by id.
+type Registry struct {
+	boards map[string]Board
+}
+
+var (
+	defaultRegistry *Registry
+	defaultErr      error
+	once            sync.Once
+)
+
+// Default returns the registry of the built-in boards merged with the user boards directory.
+func Default() (*Registry, error) {
+	once.Do(func() {
+		defaultRegistry, defaultErr = Load(UserDir())
+	})
+	return defaultRegistry, defaultErr
+}
+
+// UserDir returns the directory holding user board definitions.
+func UserDir() string {
+	if cfg := viper.ConfigFileUsed(); cfg != "" {
+		return filepath.Join(filepath.Dir(cfg), "boards")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".wio", "boards")
+}
+
+// Load builds a registry from the built-in definition and every .yaml, .yml and .json file in dir.
+func Load(dir string) (*Registry, error) {
+	r := &Registry{boards: map[string]Board{}}
+	if err := r.add(builtin, "built-in boards"); err != nil {
+		return nil, err
+	}
+
+	if dir == "" {
+		return r, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := r.add(data, path); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Registry) add(data []byte, source string) error {
+	var f file
+	// YAML is a superset of JSON
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%s: %v", source, err)
+	}
+
+	for _, b := range f.Boards {
+		if b.ID == "" || b.ServerID == "" {
+			return fmt.Errorf("%s: board requires an id and a server_id", source)
+		}
+		if b.Name == "" {
+			b.Name = b.ServerID
+		}
+		r.boards[strings.ToLower(b.ID)] = b
+	}
+	return nil
+}
+
+// Lookup finds a board by id, display name or server identifier, ignoring case.
+func (r *Registry) Lookup(name string) (Board, error) {
+	if b, ok := r.boards[strings.ToLower(name)]; ok {
+		return b, nil
+	}
+	for _, b := range r.boards {
+		if strings.EqualFold(b.ServerID, name) || strings.EqualFold(b.Name, name) {
+			return b, nil
+		}
+	}
+	return Board{}, fmt.Errorf("unknown board %q, must be one of %s", name, strings.Join(r.IDs(), ", "))
+}
+
+// List returns the boards sorted by id.
+func (r *Registry) List() []Board {
+	var list []Board
+	for _, id := range r.IDs() {
+		list = append(list, r.boards[id])
+	}
+	return list
+}
+
+// IDs returns the sorted board ids.
+func (r *Registry) IDs() []string {
+	ids := make([]string, 0, len(r.boards))
+	for id := range r.boards {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
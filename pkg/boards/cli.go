@@ -0,0 +1,48 @@
+package boards
+
+import (
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+func NewBoardsCmd() *cobra.Command {
+	var boardsCmd = &cobra.Command{
+		Use:     "boards",
+		Short:   "List the known Wio boards",
+		Aliases: []string{"board"},
+		Long: `List the boards known to the CLI with their Grove ports. Custom boards can be described in YAML or JSON
+files in the boards directory next to the configuration file, eg. ~/.wio/boards/myboard.yaml:
+
+  boards:
+    - id: myboard
+      name: My Board
+      server_id: My Board v1.0
+      ports:
+        - name: D0
+          interfaces: [GPIO]`,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("boards")
+			registry, err := Default()
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tSERVER ID\tPORTS")
+			for _, b := range registry.List() {
+				var ports []string
+				for _, p := range b.Ports {
+					ports = append(ports, fmt.Sprintf("%s(%s)", p.Name, strings.Join(p.Interfaces, "/")))
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.ID, b.Name, b.ServerID, strings.Join(ports, " "))
+			}
+			w.Flush()
+		},
+	}
+
+	return boardsCmd
+}
@@ -0,0 +1,249 @@
+package compat
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/boards"
+	"github.com/gabeduke/wio-cli-go/pkg/config"
+	"github.com/gabeduke/wio-cli-go/pkg/device"
+	"github.com/gabeduke/wio-cli-go/pkg/nodes"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+	"os"
+)
+
+// NewCompatCmds returns the commands of the Python CLI which have no counterpart with the same name.
+func NewCompatCmds() []*cobra.Command {
+	return []*cobra.Command{newCallCmd(), newSetupCmd(), newUdpCmd(), newStateCmd()}
+}
+
+func newCallCmd() *cobra.Command {
+	var callCmd = &cobra.Command{
+		Use:   "call <token> <method> <endpoint>",
+		Short: "Call the API of a node by its token (Python wio-cli syntax)",
+		Long: `Call the API of a node the way the Python CLI does, eg.
+
+  wio call 98dd464bd268d4dc4cb9b37e4e779313 GET /v1/node/GroveTempHumD0/temperature
+
+Prefer 'wio nodes call <node> <method> <path>', which takes the node name.`,
+		Args: cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("compat")
+			Warn("wio call", "wio nodes call <node> <method> <path>")
+
+			path, err := nodePath(args[2])
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			result, err := nodes.CallNode(cmd.Context(), nodes.Node{NodeKey: args[0]}, args[1], path)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			data, err := json.Marshal(result)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			fmt.Printf("%s\n", data)
+		},
+	}
+
+	return callCmd
+}
+
+func newSetupCmd() *cobra.Command {
+	var setupCmd = &cobra.Command{
+		Use:   "setup",
+		Short: "Create a node and configure it in AP mode (Python wio-cli syntax)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("compat")
+			Warn("wio setup", "wio nodes register --create")
+
+			viper.Set("create", true)
+			if err := nodes.RegisterNode(cmd.Context()); err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	return setupCmd
+}
+
+func newUdpCmd() *cobra.Command {
+	var send string
+	var udpCmd = &cobra.Command{
+		Use:   "udp --send <command>",
+		Short: "Send a command to a node in AP mode (Python wio-cli syntax)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("compat")
+			Warn("wio udp --send", "wio device send <command>")
+
+			fmt.Printf("UDP command: %s\n", send)
+			reply, err := device.Send(cmd.Context(), device.Addr(), send, device.Timeout())
+			if err != nil {
+				logger.Fatal(err)
+			}
+			fmt.Println(reply.Text)
+		},
+	}
+
+	udpCmd.Flags().StringVar(&send, "send", "", "Command sent to the node, eg. VERSION")
+	cobra.MarkFlagRequired(udpCmd.Flags(), "send")
+
+	return udpCmd
+}
+
+func newStateCmd() *cobra.Command {
+	var showSecrets bool
+	var stateCmd = &cobra.Command{
+		Use:   "state",
+		Short: "Print the server, email and token in use (Python wio-cli syntax)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			Warn("wio state", "wio config view")
+
+			server, token := viper.GetString(internal.HOST), viper.GetString(internal.TOKEN)
+			if server == "" || token == "" {
+				fmt.Println(">> Please login, use wio login")
+				os.Exit(1)
+			}
+			if !showSecrets {
+				token = config.Mask(token)
+			}
+
+			fmt.Printf("> server: %s\n", server)
+			fmt.Printf("> email:  %s\n", viper.GetString(internal.EMAIL))
+			fmt.Printf("> token:  %s\n", token)
+		},
+	}
+
+	stateCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Print the token instead of masking it")
+
+	return stateCmd
+}
+
+// NewListCmd returns `wio list` with the output of the Python CLI, used instead of the JSON list when
+// WIO_COMPAT=python is set.
+func NewListCmd() *cobra.Command {
+	var listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List all of your nodes with the output of the Python CLI",
+		Long: `List all of your nodes in the tree layout of the Python wio-cli. This output is selected by
+WIO_COMPAT=python, without it 'wio list' prints JSON like 'wio nodes list'.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("compat")
+			Warn("wio list", "wio nodes list")
+
+			list, err := nodes.ListNodes(cmd.Context())
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			resources := map[string][]nodes.Resource{}
+			for _, n := range list.Nodes {
+				if !n.Online {
+					continue
+				}
+				r, err := nodes.WellKnown(cmd.Context(), n)
+				if err != nil {
+					logger.WithField("node", n.Name).Warn(err)
+					continue
+				}
+				resources[n.NodeSn] = r
+			}
+
+			PrintList(os.Stdout, viper.GetString(internal.HOST), list.Nodes, resources)
+		},
+	}
+
+	return listCmd
+}
+
+// WrapList makes the JSON `wio list` point scripts to WIO_COMPAT=python: when its output is not a terminal, eg.
+// piped to a script written for the Python CLI, a notice is printed to stderr on every run.
+func WrapList(listCmd *cobra.Command) {
+	run := listCmd.Run
+	listCmd.Long = `List all of your nodes as JSON, like 'wio nodes list'.
+
+The Python wio-cli printed a tree instead. Set WIO_COMPAT=python to get that output from 'wio list', eg. for
+scripts written for the Python CLI; without it a notice is printed to stderr whenever the output is not a
+terminal.`
+	listCmd.Run = func(cmd *cobra.Command, args []string) {
+		if !term.IsTerminal(int(os.Stdout.Fd())) {
+			fmt.Fprintf(os.Stderr, "wio list prints JSON, set %s=python for the tree output of the Python wio-cli or use 'wio nodes list'.\n", COMPAT_ENV)
+		}
+		run(cmd, args)
+	}
+}
+
+// AddNodeCmds adds `node add <name> [board]` to the nodes command and lets `node delete <sn>` take the
+// serial number as an argument like the Python CLI.
+func AddNodeCmds(nodesCmd *cobra.Command) {
+	nodesCmd.AddCommand(newNodeAddCmd())
+
+	for _, c := range nodesCmd.Commands() {
+		if c.Name() == "delete" {
+			wrapNodeDelete(c)
+		}
+	}
+}
+
+func newNodeAddCmd() *cobra.Command {
+	var nodeAddCmd = &cobra.Command{
+		Use:   "add <name> [board]",
+		Short: "Create a node, the board defaults to the Wio Link (Python wio-cli syntax)",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("compat")
+			Warn("wio node add", "wio nodes create --name <name> --board <board>")
+
+			board := "link"
+			if len(args) == 2 {
+				board = args[1]
+			}
+			registry, err := boards.Default()
+			if err != nil {
+				logger.Fatal(err)
+			}
+			b, err := registry.Lookup(board)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			resp, err := nodes.CreateNode(cmd.Context(), args[0], b)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			fmt.Println("> success")
+			fmt.Printf("> name: %s\n", args[0])
+			fmt.Printf("> sn: %s\n", resp.NodeSn)
+			fmt.Printf("> token: %s\n", resp.NodeKey)
+		},
+	}
+
+	return nodeAddCmd
+}
+
+// wrapNodeDelete accepts `wio node delete <sn>` by passing the argument as --sn.
+func wrapNodeDelete(deleteCmd *cobra.Command) {
+	run := deleteCmd.Run
+	deleteCmd.Use = "delete [sn]"
+	deleteCmd.Args = cobra.MaximumNArgs(1)
+	deleteCmd.Run = func(cmd *cobra.Command, args []string) {
+		if len(args) == 1 {
+			if cmd.Flags().Changed("sn") {
+				internal.CreateNamedLogger("compat").Fatal("the serial number can not be given both as an argument and with --sn")
+			}
+			Warn("wio node delete", "wio nodes delete --sn <sn>")
+			cmd.Flags().Set("sn", args[0])
+		}
+		run(cmd, args)
+	}
+}
@@ -0,0 +1,121 @@
+package compat
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/nodes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// COMPAT_ENV selects the output of the Python CLI for the commands which exist in both CLIs with a
+// different output, eg. WIO_COMPAT=python wio list.
+const COMPAT_ENV = "WIO_COMPAT"
+
+// Enabled reports whether the Python CLI output was selected with WIO_COMPAT=python.
+func Enabled() bool {
+	return strings.EqualFold(os.Getenv(COMPAT_ENV), "python")
+}
+
+// warnedPath is the file recording the deprecation warnings already shown.
+func warnedPath() (string, error) {
+	dir, err := internal.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "compat.json"), nil
+}
+
+// Warn prints to stderr that a Python CLI invocation is deprecated in favor of the preferred syntax. Each
+// invocation is only warned about once, the warnings shown are recorded in ~/.wio/compat.json.
+func Warn(invocation, preferred string) {
+	logger := internal.CreateNamedLogger("compat")
+
+	path, err := warnedPath()
+	if err != nil {
+		logger.Debug(err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		logger.Debug(err)
+		return
+	}
+
+	unlock, err := internal.LockFile(path)
+	if err != nil {
+		logger.Debug(err)
+		return
+	}
+	defer unlock()
+
+	warned := map[string]bool{}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &warned)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		// the warnings already shown are lost, they are shown again once and the file is rewritten
+		logger.Warnf("Unable to read %s, the deprecation warnings may be repeated: %v", path, err)
+		warned = map[string]bool{}
+	}
+	if warned[invocation] {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "%q is the syntax of the Python wio-cli, use %q instead. This warning is only shown once.\n", invocation, preferred)
+
+	warned[invocation] = true
+	data, err = json.MarshalIndent(warned, "", "  ")
+	if err == nil {
+		err = internal.WriteFileAtomic(path, data, 0600)
+	}
+	if err != nil {
+		logger.Debug(err)
+	}
+}
+
+// PrintList writes the nodes in the tree layout of `wio list` of the Python CLI, with the API of the
+// Grove drivers of the online nodes.
+func PrintList(out io.Writer, server string, list []nodes.Node, resources map[string][]nodes.Resource) {
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	for _, n := range list {
+		state := "offline"
+		if n.Online {
+			state = "online"
+		}
+		fmt.Fprintf(out, "* %s (%s)\n", n.Name, state)
+		fmt.Fprintf(out, "  |-- sn: %s\n", n.NodeSn)
+		fmt.Fprintf(out, "  |-- token: %s\n", n.NodeKey)
+		fmt.Fprintf(out, "  |-- resource url: %s/v1/node/resources?access_token=%s\n", server, n.NodeKey)
+
+		if !n.Online {
+			continue
+		}
+		fmt.Fprintln(out, "  |-- well_known:")
+		for _, r := range resources[n.NodeSn] {
+			path := r.Path
+			if r.Args != "" {
+				path += "/" + r.Args
+			}
+			fmt.Fprintf(out, "      |-- %s %s/v1/node/%s?access_token=%s\n", r.Method, server, path, n.NodeKey)
+		}
+	}
+}
+
+// nodePath converts an endpoint of the Python CLI, eg. /v1/node/GroveTempHumD0/temperature, to the path
+// taken by nodes.CallNode.
+func nodePath(endpoint string) (string, error) {
+	if !strings.HasPrefix(endpoint, "/") {
+		endpoint = "/" + endpoint
+	}
+	path := strings.TrimPrefix(endpoint, "/v1/node/")
+	if path == endpoint {
+		return "", fmt.Errorf("%q is not a node endpoint, expected /v1/node/<driver>/<property>", endpoint)
+	}
+	return path, nil
+}
@@ -0,0 +1,310 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+)
+
+func NewConfigCmd() *cobra.Command {
+	var configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Read and write the CLI configuration",
+		Long: `Read and write single settings of the configuration file without re-running 'wio user configure'.
+
+Settings are the top level keys (` + strings.Join(names(), ", ") + `).
+Values are validated before they are written.`,
+	}
+
+	configCmd.AddCommand(newConfigGetCmd())
+	configCmd.AddCommand(newConfigSetCmd())
+	configCmd.AddCommand(newConfigUnsetCmd())
+	configCmd.AddCommand(newConfigViewCmd())
+	configCmd.AddCommand(newConfigEditCmd())
+	configCmd.AddCommand(newConfigPathCmd())
+	configCmd.AddCommand(newConfigMigrateCmd())
+	configCmd.AddCommand(newConfigSchemaCmd())
+
+	return configCmd
+}
+
+func newConfigGetCmd() *cobra.Command {
+	var showSecrets bool
+	var configGetCmd = &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print the effective value of a setting",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("config")
+			k, err := Lookup(args[0])
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			if !viper.IsSet(k.Name) {
+				logger.Fatalf("%s is not set", k.Name)
+			}
+
+			value := viper.Get(k.Name)
+			if k.Secret && !showSecrets {
+				value = Mask(fmt.Sprint(value))
+			}
+			switch v := value.(type) {
+			case []string:
+				fmt.Println(strings.Join(v, ","))
+			default:
+				fmt.Println(v)
+			}
+		},
+	}
+
+	configGetCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Print secrets such as the token in clear")
+
+	return configGetCmd
+}
+
+func newConfigSetCmd() *cobra.Command {
+	var configSetCmd = &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Validate and write a setting",
+		Long: `Validate and write a setting to the configuration file, eg.
+
+  wio config set mserver https://wio.example.com
+  wio config set profiles.lab.mserver https://wio.lab.example.com
+  wio config set aliases.gh greenhouse-node-1`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("config")
+			if err := Set(args[0], args[1]); err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	return configSetCmd
+}
+
+func newConfigUnsetCmd() *cobra.Command {
+	var configUnsetCmd = &cobra.Command{
+		Use:   "unset <key>",
+		Short: "Remove a setting",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("config")
+			if err := Unset(args[0]); err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	return configUnsetCmd
+}
+
+func newConfigViewCmd() *cobra.Command {
+	var showSecrets bool
+	var output string
+	var configViewCmd = &cobra.Command{
+		Use:   "view",
+		Short: "Show the effective configuration and where each value comes from",
+		Long: `Show the effective configuration: the configuration file merged with the active profile, environment
+variables and flags, with the source of each value. Secrets are masked unless --show-secrets is given.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("config")
+			settings, err := Effective(cmd.Root().PersistentFlags(), showSecrets)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			if output == "json" {
+				data, err := json.MarshalIndent(settings, "", "  ")
+				if err != nil {
+					logger.Fatal(err)
+				}
+				fmt.Println(string(data))
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+			for _, s := range settings {
+				value := fmt.Sprint(s.Value)
+				if v, ok := s.Value.([]string); ok {
+					value = strings.Join(v, ",")
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, value, s.Source)
+			}
+			w.Flush()
+		},
+	}
+
+	configViewCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Print secrets such as the token in clear")
+	configViewCmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+
+	return configViewCmd
+}
+
+func newConfigEditCmd() *cobra.Command {
+	var configEditCmd = &cobra.Command{
+		Use:   "edit",
+		Short: "Edit the configuration file with $VISUAL or $EDITOR",
+		Long: `Open a copy of the configuration file in $VISUAL or $EDITOR (vi by default). The copy replaces the
+configuration file once it parses and its settings are valid.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("config")
+			if err := edit(); err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	return configEditCmd
+}
+
+func edit() error {
+	logger := internal.CreateNamedLogger("config")
+
+	settings, err := internal.ReadConfig()
+	if err != nil {
+		return err
+	}
+	original, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir, err := internal.ConfigDir()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "config-*.json")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(original, '\n'))
+	tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// the editor may carry arguments, eg. "code --wait"
+	fields := strings.Fields(editor)
+	c := exec.Command(fields[0], append(fields[1:], tmp.Name())...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("%s: %v, the edited copy is kept in %s", editor, err, tmp.Name())
+	}
+
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(bytes.TrimSpace(data), bytes.TrimSpace(original)) {
+		os.Remove(tmp.Name())
+		fmt.Println("No changes")
+		return nil
+	}
+
+	edited := map[string]interface{}{}
+	if err := json.Unmarshal(data, &edited); err != nil {
+		return fmt.Errorf("the edited configuration can not be parsed, it is kept in %s: %v", tmp.Name(), err)
+	}
+	warnings, err := Validate(edited)
+	for _, w := range warnings {
+		logger.Warn(w)
+	}
+	if err != nil {
+		return fmt.Errorf("%v, the edited configuration is kept in %s", err, tmp.Name())
+	}
+
+	if err := internal.WriteConfig(edited); err != nil {
+		return err
+	}
+	os.Remove(tmp.Name())
+
+	path, _ := internal.ConfigFile()
+	fmt.Printf("Updated %s\n", path)
+	return nil
+}
+
+func newConfigPathCmd() *cobra.Command {
+	var configPathCmd = &cobra.Command{
+		Use:   "path",
+		Short: "Print the path of the configuration file",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("config")
+			path, err := internal.ConfigFile()
+			if err != nil {
+				logger.Fatal(err)
+			}
+			fmt.Println(path)
+		},
+	}
+
+	return configPathCmd
+}
+
+func newConfigMigrateCmd() *cobra.Command {
+	var configMigrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Rewrite the configuration file in the current layout",
+		Long: `Rewrite the configuration file in the current layout, eg. one written by the Python CLI or an older
+version of wio. The old file is kept as config.json.v<version>.bak.
+
+Files are also migrated the first time a setting is saved, this command only does it up front.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("config")
+			from, changes, err := internal.MigrateConfig()
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			path, _ := internal.ConfigFile()
+			if from == internal.CONFIG_VERSION {
+				fmt.Printf("%s is already version %d\n", path, from)
+				return
+			}
+
+			for _, c := range changes {
+				fmt.Println(c)
+			}
+			fmt.Printf("Migrated %s from version %d to %d, the old file is kept in %s\n",
+				path, from, internal.CONFIG_VERSION, internal.BackupFile(path, from))
+		},
+	}
+
+	return configMigrateCmd
+}
+
+func newConfigSchemaCmd() *cobra.Command {
+	var configSchemaCmd = &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the configuration file",
+		Long: `Print the JSON Schema of the configuration file. Editors validate and complete the file when it
+refers to a copy of the schema with a "$schema" key.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			os.Stdout.Write(Schema)
+		},
+	}
+
+	return configSchemaCmd
+}
@@ -0,0 +1,415 @@
+package config
+
+import (
+	"crypto/x509"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key is a setting of the configuration file.
+type Key struct {
+	Name        string
+	Description string
+	Flag        string // root flag overriding the setting
+	Secret      bool   // masked by view and get
+	Profile     bool   // can be set per profile
+	Validate    func(string) (interface{}, error)
+}
+
+// Keys are the known top level settings.
+var Keys = []Key{
+	{Name: internal.HOST, Description: "server address", Profile: true, Validate: validateServer},
+	{Name: internal.HOST_IP, Description: "IP address dialed instead of resolving the server", Profile: true, Validate: validateIP},
+	{Name: internal.TOKEN, Description: "API token", Secret: true, Profile: true, Validate: validateNotEmpty},
+	{Name: internal.EMAIL, Description: "account email address", Profile: true, Validate: validateEmail},
+	{Name: internal.PROFILE, Description: "active profile", Flag: internal.PROFILE, Validate: validateProfile},
+	{Name: internal.CA_BUNDLE, Description: "PEM file of extra trusted certificate authorities", Profile: true, Validate: validateCABundle},
+	{Name: internal.CLIENT_CERT, Description: "PEM client certificate", Profile: true, Validate: validateFile},
+	{Name: internal.CLIENT_KEY, Description: "PEM client private key", Profile: true, Validate: validateFile},
+	{Name: internal.INSECURE_SKIP_VERIFY, Description: "disable server certificate verification", Profile: true, Validate: validateBool},
+	{Name: internal.PROXY, Description: "http, https or socks5 proxy URL", Profile: true, Validate: validateProxy},
+	{Name: internal.RESOLVE, Description: "comma separated host:ip pins", Flag: internal.RESOLVE, Profile: true, Validate: validateResolve},
+	{Name: internal.TIMEOUT, Description: "timeout of each API request", Flag: internal.TIMEOUT, Profile: true, Validate: validateDuration},
+	{Name: internal.RETRIES, Description: "retries of idempotent API requests", Flag: internal.RETRIES, Profile: true, Validate: validateRetries},
+	{Name: "loglevel", Description: "log level", Flag: "log-level", Validate: validateLogLevel},
+	{Name: internal.DEVICE_ADDR, Description: "UDP address of a device in AP mode", Validate: validateHostPort},
+	{Name: internal.DEVICE_TIMEOUT, Description: "wait for the reply of a device in AP mode", Validate: validateDuration},
+}
+
+// Lookup returns the key of a setting. Besides the top level keys it accepts profiles.<profile>.<key>
+// and aliases.<alias>.
+func Lookup(name string) (Key, error) {
+	name = strings.ToLower(name)
+	parts := strings.Split(name, ".")
+
+	switch parts[0] {
+	case internal.PROFILES:
+		if len(parts) != 3 || parts[1] == "" {
+			return Key{}, fmt.Errorf("profile settings are named profiles.<profile>.<key>, eg. profiles.lab.mserver")
+		}
+		k, err := Lookup(parts[2])
+		if err != nil {
+			return Key{}, err
+		}
+		if !k.Profile {
+			return Key{}, fmt.Errorf("%s can not be set per profile", k.Name)
+		}
+		k.Name = name
+		return k, nil
+	case internal.ALIASES:
+		if len(parts) != 2 || parts[1] == "" {
+			return Key{}, fmt.Errorf("aliases are named aliases.<alias>, eg. aliases.gh")
+		}
+		return Key{Name: name, Description: "node alias", Validate: validateNotEmpty}, nil
+	case "labels":
+		return Key{}, fmt.Errorf("labels are managed with `wio nodes label`")
+	case internal.VERSION:
+		return Key{}, fmt.Errorf("the version is managed by wio, see `wio config migrate`")
+	}
+
+	for _, k := range Keys {
+		if k.Name == name {
+			return k, nil
+		}
+	}
+	return Key{}, fmt.Errorf("unknown setting %q, the known settings are %s", name, strings.Join(names(), ", "))
+}
+
+func names() []string {
+	var n []string
+	for _, k := range Keys {
+		n = append(n, k.Name)
+	}
+	return append(n, "profiles.<profile>.<key>", "aliases.<alias>")
+}
+
+// Setting is the effective value of a setting and where it comes from.
+type Setting struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// Effective returns the settings which have a value, with their source: a flag, an environment
+// variable, the active profile, the configuration file or a default.
+func Effective(flags *pflag.FlagSet, showSecrets bool) ([]Setting, error) {
+	file, err := internal.ReadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	profile := viper.GetString(internal.PROFILE)
+	var profileSettings map[string]interface{}
+	if profiles, ok := file[internal.PROFILES].(map[string]interface{}); ok {
+		profileSettings, _ = profiles[profile].(map[string]interface{})
+	}
+
+	var settings []Setting
+	for _, k := range Keys {
+		s := Setting{Key: k.Name, Value: viper.Get(k.Name)}
+
+		var flag *pflag.Flag
+		if k.Flag != "" && flags != nil {
+			flag = flags.Lookup(k.Flag)
+		}
+		_, inProfile := profileSettings[k.Name]
+		_, inFile := file[k.Name]
+
+		switch {
+		case flag != nil && flag.Changed:
+			s.Source = "flag --" + k.Flag
+		case internal.EnvSet(k.Name):
+			s.Source = "env " + internal.EnvVar(k.Name)
+		case inProfile:
+			s.Source = "profile " + profile
+		case inFile:
+			s.Source = "file"
+		case flag != nil && flag.DefValue != "" && flag.DefValue != "[]":
+			s.Source = "default"
+		default:
+			continue
+		}
+
+		if k.Secret && !showSecrets {
+			s.Value = Mask(fmt.Sprint(s.Value))
+		}
+		settings = append(settings, s)
+	}
+
+	aliases := viper.GetStringMapString(internal.ALIASES)
+	for _, name := range sortedKeys(aliases) {
+		settings = append(settings, Setting{Key: internal.ALIASES + "." + name, Value: aliases[name], Source: "file"})
+	}
+
+	if profiles := internal.Profiles(); len(profiles) > 0 {
+		settings = append(settings, Setting{Key: internal.PROFILES, Value: strings.Join(profiles, ", "), Source: "file"})
+	}
+
+	return settings, nil
+}
+
+// Mask hides a secret, keeping its last 4 characters when it is long enough to stay secret.
+func Mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) < 16 {
+		return "********"
+	}
+	return "********" + secret[len(secret)-4:]
+}
+
+// Set validates a value and writes it to the configuration file.
+func Set(name, value string) error {
+	k, err := Lookup(name)
+	if err != nil {
+		return err
+	}
+
+	v, err := k.Validate(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", k.Name, err)
+	}
+
+	return internal.UpdateConfig(k.Name, v)
+}
+
+// Unset removes a setting from the configuration file.
+func Unset(name string) error {
+	k, err := Lookup(name)
+	if err != nil {
+		return err
+	}
+
+	return internal.UpdateConfig(k.Name, nil)
+}
+
+// Validate checks the settings of a configuration file. Unknown settings are returned as warnings.
+func Validate(settings map[string]interface{}) (warnings []string, err error) {
+	// validated as they will be written, migrated to the current version
+	normalized := make(map[string]interface{}, len(settings))
+	for k, v := range settings {
+		normalized[k] = v
+	}
+	if _, _, err := internal.Migrate(normalized); err != nil {
+		return nil, err
+	}
+	settings = normalized
+
+	if _, err := internal.DecodeConfig(settings); err != nil {
+		return nil, err
+	}
+
+	for _, name := range sortedKeys(settings) {
+		value := settings[name]
+		switch strings.ToLower(name) {
+		case internal.PROFILES, internal.ALIASES:
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return warnings, fmt.Errorf("%s must be an object", name)
+			}
+			for _, sub := range sortedKeys(m) {
+				if strings.ToLower(name) == internal.ALIASES {
+					if err := validate(name+"."+sub, m[sub]); err != nil {
+						return warnings, err
+					}
+					continue
+				}
+				profile, ok := m[sub].(map[string]interface{})
+				if !ok {
+					return warnings, fmt.Errorf("%s.%s must be an object", name, sub)
+				}
+				for _, key := range sortedKeys(profile) {
+					if err := validate(name+"."+sub+"."+key, profile[key]); err != nil {
+						return warnings, err
+					}
+				}
+			}
+		case "labels", internal.VERSION, "$schema":
+		default:
+			if _, err := Lookup(name); err != nil {
+				warnings = append(warnings, err.Error())
+				continue
+			}
+			if err := validate(name, value); err != nil {
+				return warnings, err
+			}
+		}
+	}
+
+	if p, ok := settings[internal.PROFILE].(string); ok && p != "" {
+		profiles, _ := settings[internal.PROFILES].(map[string]interface{})
+		if _, ok := profiles[p]; !ok {
+			return warnings, fmt.Errorf("profile %q is not defined in profiles", p)
+		}
+	}
+
+	return warnings, nil
+}
+
+func validate(name string, value interface{}) error {
+	k, err := Lookup(name)
+	if err != nil {
+		return err
+	}
+	if k.Name == internal.PROFILE {
+		// checked against the edited profiles by Validate
+		return nil
+	}
+
+	var s string
+	switch v := value.(type) {
+	case []interface{}:
+		var parts []string
+		for _, p := range v {
+			parts = append(parts, fmt.Sprint(p))
+		}
+		s = strings.Join(parts, ",")
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if _, err := k.Validate(s); err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func validateNotEmpty(s string) (interface{}, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("must not be empty")
+	}
+	return s, nil
+}
+
+func validateServer(s string) (interface{}, error) {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, fmt.Errorf("%q is not an http or https URL", s)
+	}
+	return strings.TrimSuffix(s, "/"), nil
+}
+
+func validateIP(s string) (interface{}, error) {
+	if net.ParseIP(s) == nil {
+		return nil, fmt.Errorf("%q is not an IP address", s)
+	}
+	return s, nil
+}
+
+func validateHostPort(s string) (interface{}, error) {
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func validateEmail(s string) (interface{}, error) {
+	if i := strings.Index(s, "@"); i <= 0 || i == len(s)-1 {
+		return nil, fmt.Errorf("%q is not an email address", s)
+	}
+	return s, nil
+}
+
+func validateProfile(s string) (interface{}, error) {
+	for _, p := range internal.Profiles() {
+		if p == s {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("profile %q is not defined, the profiles are %v", s, internal.Profiles())
+}
+
+func validateFile(s string) (interface{}, error) {
+	if _, err := os.Stat(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func validateCABundle(s string) (interface{}, error) {
+	data, err := os.ReadFile(s)
+	if err != nil {
+		return nil, err
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", s)
+	}
+	return s, nil
+}
+
+func validateBool(s string) (interface{}, error) {
+	return strconv.ParseBool(s)
+}
+
+func validateProxy(s string) (interface{}, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return s, nil
+	}
+	return nil, fmt.Errorf("unsupported scheme %q, use http, https or socks5", u.Scheme)
+}
+
+func validateResolve(s string) (interface{}, error) {
+	var pins []string
+	for _, pin := range strings.Split(s, ",") {
+		host, ip, ok := strings.Cut(strings.TrimSpace(pin), ":")
+		if !ok || host == "" || net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("%q is not host:ip", pin)
+		}
+		pins = append(pins, host+":"+ip)
+	}
+	return pins, nil
+}
+
+func validateDuration(s string) (interface{}, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, err
+	}
+	if d <= 0 {
+		return nil, fmt.Errorf("must be positive")
+	}
+	return d.String(), nil
+}
+
+func validateRetries(s string) (interface{}, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("must not be negative")
+	}
+	return n, nil
+}
+
+func validateLogLevel(s string) (interface{}, error) {
+	switch s {
+	case "info", "debug", "warn", "error":
+		return s, nil
+	}
+	return nil, fmt.Errorf(`must be one of "info", "debug", "warn", "error"`)
+}
@@ -0,0 +1,9 @@
+package config
+
+import _ "embed"
+
+// Schema is the JSON Schema of the configuration file, for editors and external tooling. It describes
+// internal.Config.
+//
+//go:embed schema.json
+var Schema []byte
@@ -0,0 +1,29 @@
+package dashboard
+
+import (
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+func NewDashboardCmd() *cobra.Command {
+	var interval time.Duration
+	var dashboardCmd = &cobra.Command{
+		Use:   "dashboard",
+		Short: "Terminal dashboard of your nodes",
+		Long: `Full screen terminal dashboard listing your nodes with their board and online status.
+Open a node to see its resources with live sensor values, the websocket event log and to toggle writable
+properties.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("dashboard")
+			err := Run(cmd.Context(), interval)
+			if err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	dashboardCmd.Flags().DurationVar(&interval, "interval", 5*time.Second, "Refresh interval of node status and sensor values")
+
+	return dashboardCmd
+}
@@ -0,0 +1,420 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/gabeduke/wio-cli-go/pkg/nodes"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxEvents = 10
+
+type view int
+
+const (
+	listView view = iota
+	nodeView
+)
+
+type nodesMsg struct {
+	list nodes.ListResp
+	err  error
+}
+
+type resourcesMsg struct {
+	sn        string
+	resources []nodes.Resource
+	err       error
+}
+
+type valuesMsg struct {
+	sn     string
+	values map[string]string
+	states map[string]bool
+}
+
+type eventMsg struct {
+	sn    string
+	event nodes.NodeEvent
+}
+
+type eventErrMsg struct {
+	sn  string
+	err error
+}
+
+type callMsg struct {
+	path   string
+	result string
+	err    error
+}
+
+type tickMsg time.Time
+
+// model is the bubbletea model of the dashboard: a fleet list and a drill down view of a single node.
+type model struct {
+	ctx      context.Context
+	interval time.Duration
+	view     view
+	status   string
+
+	nodes  []nodes.Node
+	cursor int
+
+	node      nodes.Node
+	resources []nodes.Resource
+	values    map[string]string
+	toggles   map[string]bool
+	rcursor   int
+	events    []string
+	eventCh   chan nodes.NodeEvent
+	stream    context.Context
+	stop      context.CancelFunc
+}
+
+func newModel(ctx context.Context, interval time.Duration) model {
+	return model{ctx: ctx, interval: interval}
+}
+
+func (m model) Init() tea.Cmd {
+	return tea.Batch(loadNodes(m.ctx), tick(m.interval))
+}
+
+func loadNodes(ctx context.Context) tea.Cmd {
+	return func() tea.Msg {
+		list, err := nodes.ListNodes(ctx)
+		return nodesMsg{list: list, err: err}
+	}
+}
+
+func tick(d time.Duration) tea.Cmd {
+	return tea.Tick(d, func(t time.Time) tea.Msg { return tickMsg(t) })
+}
+
+func loadResources(ctx context.Context, node nodes.Node) tea.Cmd {
+	return func() tea.Msg {
+		resources, err := nodes.WellKnown(ctx, node)
+		return resourcesMsg{sn: node.NodeSn, resources: resources, err: err}
+	}
+}
+
+// readValues reads every GET resource which takes no arguments. The reads of a single on or off value are
+// also kept as states for the toggles.
+func readValues(ctx context.Context, node nodes.Node, resources []nodes.Resource) tea.Cmd {
+	return func() tea.Msg {
+		values := map[string]string{}
+		states := map[string]bool{}
+		for _, r := range resources {
+			if r.Method != "GET" || r.Args != "" {
+				continue
+			}
+			result, err := nodes.CallNode(ctx, node, "GET", r.Path)
+			if err != nil {
+				values[r.Path] = "error: " + err.Error()
+				continue
+			}
+			values[r.Path] = formatResult(result)
+			if on, ok := state(result); ok {
+				states[r.Path] = on
+			}
+		}
+		return valuesMsg{sn: node.NodeSn, values: values, states: states}
+	}
+}
+
+func subscribe(ctx context.Context, node nodes.Node, ch chan nodes.NodeEvent) tea.Cmd {
+	return func() tea.Msg {
+		err := nodes.SubscribeEvents(ctx, node, ch)
+		return eventErrMsg{sn: node.NodeSn, err: err}
+	}
+}
+
+func waitEvent(ctx context.Context, sn string, ch chan nodes.NodeEvent) tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case e := <-ch:
+			return eventMsg{sn: sn, event: e}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func call(ctx context.Context, node nodes.Node, path string) tea.Cmd {
+	return func() tea.Msg {
+		result, err := nodes.CallNode(ctx, node, "POST", path)
+		return callMsg{path: path, result: formatResult(result), err: err}
+	}
+}
+
+func formatResult(result map[string]interface{}) string {
+	keys := make([]string, 0, len(result))
+	for k := range result {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		v, _ := json.Marshal(result[k])
+		parts = append(parts, fmt.Sprintf("%s=%s", k, v))
+	}
+	return strings.Join(parts, " ")
+}
+
+// state returns a read as on or off when it is a single boolean, 0 or 1, or on or off, eg. {"onoff": 1}.
+// Other values, eg. a servo angle, are not states.
+func state(result map[string]interface{}) (bool, bool) {
+	if len(result) != 1 {
+		return false, false
+	}
+	for _, v := range result {
+		switch v := v.(type) {
+		case float64:
+			return v == 1, v == 0 || v == 1
+		case bool:
+			return v, true
+		case string:
+			switch strings.ToLower(v) {
+			case "1", "on", "true":
+				return true, true
+			case "0", "off", "false":
+				return false, true
+			}
+		}
+	}
+	return false, false
+}
+
+// writable reports whether a resource is a single argument write. It is offered as a toggle between 0 and 1
+// only when its read back is an on or off state, see readBack.
+func writable(r nodes.Resource) bool {
+	return r.Method == "POST" && strings.Count(r.Args, "{") == 1
+}
+
+// readBack returns the GET resource reporting the state set by a writable resource: the same property of the
+// same driver, or a property starting with its name, eg. GroveRelayD1/onoff_status for GroveRelayD1/onoff.
+func readBack(w nodes.Resource, resources []nodes.Resource) (nodes.Resource, bool) {
+	var prefixed []nodes.Resource
+	for _, r := range resources {
+		if r.Method != "GET" || r.Args != "" || r.Instance() != w.Instance() {
+			continue
+		}
+		if r.Property() == w.Property() {
+			return r, true
+		}
+		if strings.HasPrefix(r.Property(), w.Property()) {
+			prefixed = append(prefixed, r)
+		}
+	}
+	if len(prefixed) == 1 {
+		return prefixed[0], true
+	}
+	return nodes.Resource{}, false
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		return m.key(msg)
+	case tickMsg:
+		if m.view == nodeView {
+			return m, tea.Batch(readValues(m.ctx, m.node, m.resources), tick(m.interval))
+		}
+		return m, tea.Batch(loadNodes(m.ctx), tick(m.interval))
+	case nodesMsg:
+		if msg.err != nil {
+			m.status = msg.err.Error()
+			return m, nil
+		}
+		m.nodes = msg.list.Nodes
+		if m.cursor >= len(m.nodes) {
+			m.cursor = 0
+		}
+		m.status = "updated " + time.Now().Format(time.Kitchen)
+	case resourcesMsg:
+		if m.view != nodeView || msg.sn != m.node.NodeSn {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.status = msg.err.Error()
+			return m, nil
+		}
+		m.resources = msg.resources
+		return m, readValues(m.ctx, m.node, m.resources)
+	case valuesMsg:
+		if m.view == nodeView && msg.sn == m.node.NodeSn {
+			m.values = msg.values
+			for _, r := range m.resources {
+				if !writable(r) {
+					continue
+				}
+				delete(m.toggles, r.Path)
+				if g, ok := readBack(r, m.resources); ok {
+					if on, ok := msg.states[g.Path]; ok {
+						m.toggles[r.Path] = on
+					}
+				}
+			}
+			m.status = "updated " + time.Now().Format(time.Kitchen)
+		}
+	case eventMsg:
+		if m.view != nodeView || msg.sn != m.node.NodeSn {
+			return m, nil
+		}
+		data, _ := json.Marshal(msg.event)
+		m.events = append(m.events, fmt.Sprintf("%s %s", time.Now().Format("15:04:05"), data))
+		if len(m.events) > maxEvents {
+			m.events = m.events[len(m.events)-maxEvents:]
+		}
+		return m, waitEvent(m.stream, m.node.NodeSn, m.eventCh)
+	case eventErrMsg:
+		if m.view == nodeView && msg.sn == m.node.NodeSn && msg.err != nil {
+			m.events = append(m.events, "event stream closed: "+msg.err.Error())
+		}
+	case callMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("%s: %v", msg.path, msg.err)
+		} else {
+			m.status = fmt.Sprintf("%s: %s", msg.path, msg.result)
+		}
+		return m, readValues(m.ctx, m.node, m.resources)
+	}
+
+	return m, nil
+}
+
+func (m model) key(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "q":
+		if m.stop != nil {
+			m.stop()
+		}
+		return m, tea.Quit
+	}
+
+	if m.view == listView {
+		switch msg.String() {
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.nodes)-1 {
+				m.cursor++
+			}
+		case "r":
+			return m, loadNodes(m.ctx)
+		case "enter", "l":
+			if len(m.nodes) == 0 {
+				return m, nil
+			}
+			m.view = nodeView
+			m.node = m.nodes[m.cursor]
+			m.resources = nil
+			m.values = map[string]string{}
+			m.toggles = map[string]bool{}
+			m.rcursor = 0
+			m.events = nil
+			m.eventCh = make(chan nodes.NodeEvent)
+			m.stream, m.stop = context.WithCancel(m.ctx)
+			return m, tea.Batch(loadResources(m.ctx, m.node), subscribe(m.stream, m.node, m.eventCh), waitEvent(m.stream, m.node.NodeSn, m.eventCh))
+		}
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "esc", "backspace", "h":
+		m.stop()
+		m.stop = nil
+		m.view = listView
+		return m, loadNodes(m.ctx)
+	case "up", "k":
+		if m.rcursor > 0 {
+			m.rcursor--
+		}
+	case "down", "j":
+		if m.rcursor < len(m.resources)-1 {
+			m.rcursor++
+		}
+	case "r":
+		return m, readValues(m.ctx, m.node, m.resources)
+	case "enter", "t", " ":
+		if m.rcursor >= len(m.resources) {
+			return m, nil
+		}
+		r := m.resources[m.rcursor]
+		on, ok := m.toggles[r.Path]
+		if !ok {
+			m.status = "selected resource is not a switch, only properties read back as on or off are toggled"
+			return m, nil
+		}
+		m.toggles[r.Path] = !on
+		value := "0"
+		if !on {
+			value = "1"
+		}
+		return m, call(m.ctx, m.node, r.Path+"/"+value)
+	}
+
+	return m, nil
+}
+
+func (m model) View() string {
+	var b strings.Builder
+	if m.view == listView {
+		b.WriteString("Wio nodes\n\n")
+		b.WriteString(fmt.Sprintf("  %-20s %-16s %-34s %s\n", "NAME", "BOARD", "SN", "STATUS"))
+		for i, n := range m.nodes {
+			cursor := " "
+			if i == m.cursor {
+				cursor = ">"
+			}
+			status := "offline"
+			if n.Online {
+				status = "online"
+			}
+			b.WriteString(fmt.Sprintf("%s %-20s %-16s %-34s %s\n", cursor, n.Name, n.Board, n.NodeSn, status))
+		}
+		b.WriteString("\n" + m.status + "\n")
+		b.WriteString("↑/↓ select • enter open • r refresh • q quit\n")
+		return b.String()
+	}
+
+	b.WriteString(fmt.Sprintf("%s (%s, %s)\n\nResources\n", m.node.Name, m.node.Board, m.node.NodeSn))
+	if m.resources == nil {
+		b.WriteString("  loading...\n")
+	}
+	for i, r := range m.resources {
+		cursor := " "
+		if i == m.rcursor {
+			cursor = ">"
+		}
+		value := m.values[r.Path]
+		if on, ok := m.toggles[r.Path]; ok {
+			value = fmt.Sprintf("[toggle: %t]", on)
+		} else if r.Method == "POST" {
+			value = r.Args
+		}
+		b.WriteString(fmt.Sprintf("%s %-5s %-40s %s\n", cursor, r.Method, r.Path, value))
+	}
+
+	b.WriteString("\nEvents\n")
+	for _, e := range m.events {
+		b.WriteString("  " + e + "\n")
+	}
+
+	b.WriteString("\n" + m.status + "\n")
+	b.WriteString("↑/↓ select • enter toggle • r refresh • esc back • q quit\n")
+	return b.String()
+}
+
+// Run starts the full screen dashboard.
+func Run(ctx context.Context, interval time.Duration) error {
+	_, err := tea.NewProgram(newModel(ctx, interval), tea.WithAltScreen(), tea.WithContext(ctx)).Run()
+	return err
+}
@@ -0,0 +1,228 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/esp"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func NewDeviceCmd() *cobra.Command {
+	var deviceCmd = &cobra.Command{
+		Use:   "device",
+		Short: "Talk to a Wio device in AP mode",
+		Long: `Talk to a Wio device in AP mode over its UDP port. Hold the func button of the device for 5 seconds to
+enter AP mode, then connect to its Wi-Fi access point.
+
+The address and the wait for a reply can also be set with the device_addr and device_timeout settings or the
+WIO_DEVICE_ADDR and WIO_DEVICE_TIMEOUT environment variables.`,
+	}
+
+	deviceCmd.PersistentFlags().String("addr", internal.NODE_UDP_ADDR, "UDP address of the device")
+	viper.BindPFlag(internal.DEVICE_ADDR, deviceCmd.PersistentFlags().Lookup("addr"))
+	deviceCmd.PersistentFlags().Duration("reply-timeout", DefaultTimeout, "wait for the reply of the device")
+	viper.BindPFlag(internal.DEVICE_TIMEOUT, deviceCmd.PersistentFlags().Lookup("reply-timeout"))
+
+	deviceCmd.AddCommand(newDeviceSendCmd())
+	deviceCmd.AddCommand(newDeviceConsoleCmd())
+	deviceCmd.AddCommand(newDeviceFlashCmd())
+	deviceCmd.AddCommand(newDeviceMonitorCmd())
+
+	return deviceCmd
+}
+
+func newDeviceSendCmd() *cobra.Command {
+	var output, ssid, password, key, sn string
+	var deviceSendCmd = &cobra.Command{
+		Use:   "send <command>",
+		Short: "Send a command to the device and print its reply",
+		Long: `Send a command to the device and print its reply with the round trip time, eg.
+
+  wio device send VERSION
+  wio device send version
+  wio device send apcfg --ssid home --password secret --key <node key> --sn <node sn>
+
+The apcfg shortcut builds the APCFG command from the flags, with the configured server address and IP.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("device")
+
+			command := Expand(strings.Join(args, " "))
+			if strings.EqualFold(command, "apcfg") {
+				if ssid == "" || key == "" || sn == "" {
+					logger.Fatal("apcfg requires --ssid, --key and --sn")
+				}
+				command = APConfig(ssid, password, key, sn, viper.GetString(internal.HOST), viper.GetString(internal.HOST_IP))
+			}
+
+			r, err := Send(cmd.Context(), Addr(), command, Timeout())
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			if output == "json" {
+				r.Command = Redact(r.Command)
+				data, err := json.MarshalIndent(r, "", "  ")
+				if err != nil {
+					logger.Fatal(err)
+				}
+				fmt.Printf("%s\n", data)
+				return
+			}
+			fmt.Printf("%s (%s)\n", r.Text, r.Elapsed.Round(10*time.Microsecond))
+		},
+	}
+
+	deviceSendCmd.Flags().StringVarP(&output, "output", "o", "text", `Output format: "text" or "json"`)
+	deviceSendCmd.Flags().StringVar(&ssid, "ssid", "", "Wi-Fi network joined by the device, for apcfg")
+	deviceSendCmd.Flags().StringVar(&password, "password", "", "Wi-Fi password, for apcfg")
+	deviceSendCmd.Flags().StringVar(&key, "key", "", "Node key, for apcfg")
+	deviceSendCmd.Flags().StringVar(&sn, "sn", "", "Node serial number, for apcfg")
+
+	return deviceSendCmd
+}
+
+func newDeviceConsoleCmd() *cobra.Command {
+	var deviceConsoleCmd = &cobra.Command{
+		Use:   "console",
+		Short: "Interactive console to the device",
+		Long: `Start an interactive console sending each line to the device and printing its reply with the round trip
+time. version and apcfg are shortcuts for the VERSION and APCFG commands, apcfg prompts for each field. The
+command history is kept in device_history next to the configuration file. Type help inside the console for a
+list of commands.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("device")
+			err := NewConsole(Addr(), Timeout(), os.Stdout).Run()
+			if err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	return deviceConsoleCmd
+}
+
+func newDeviceFlashCmd() *cobra.Command {
+	var opts FlashOptions
+	var offset, stub string
+	var noCompress, noVerify, noReset bool
+	var deviceFlashCmd = &cobra.Command{
+		Use:   "flash <firmware.bin>",
+		Short: "Write a firmware image to an ESP8266 board over USB serial",
+		Long: `Write a firmware image to a Wio Link or Wio Node, or any ESP8266 board, over its serial bootloader.
+The board is reset into the bootloader with the DTR and RTS lines of the USB serial adapter, otherwise hold
+its flash button while resetting it.
+
+  wio device flash --port /dev/ttyUSB0 firmware.bin
+  wio device flash --port /dev/ttyUSB0 --stub stub_flasher_8266.json --erase-all firmware.bin
+
+The ESP8266 ROM bootloader only writes uncompressed data and can not compute checksums. Compressed writes,
+MD5 verification and --erase-all require the flasher stub of esptool, given with --stub as the JSON file
+shipped with esptool (esptool/targets/stub_flasher/stub_flasher_8266.json). Without it the image is written
+uncompressed and is not verified.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("device")
+
+			image, err := os.ReadFile(args[0])
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			o, err := strconv.ParseUint(offset, 0, 32)
+			if err != nil {
+				logger.Fatalf("invalid offset %q: %v", offset, err)
+			}
+			opts.Offset = uint32(o)
+			opts.Compress, opts.Verify, opts.Reset = !noCompress, !noVerify, !noReset
+
+			if stub != "" {
+				if opts.Stub, err = esp.ReadStub(stub); err != nil {
+					logger.Fatal(err)
+				}
+			} else if opts.EraseAll {
+				logger.Fatal("--erase-all requires the flasher stub, see --stub")
+			}
+
+			if err := Flash(cmd.Context(), logger, image, opts, os.Stdout); err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	deviceFlashCmd.Flags().StringVar(&opts.Port, "port", "", "Serial port of the board, eg. /dev/ttyUSB0 or COM3")
+	deviceFlashCmd.MarkFlagRequired("port")
+	deviceFlashCmd.Flags().IntVar(&opts.Baud, "baud", esp.DefaultBaud, "Baud rate of the serial port")
+	deviceFlashCmd.Flags().StringVar(&offset, "offset", "0x0", "Flash address of the image")
+	deviceFlashCmd.Flags().StringVar(&stub, "stub", "", "esptool flasher stub (JSON), enables compression, verification and --erase-all")
+	deviceFlashCmd.Flags().BoolVar(&opts.EraseAll, "erase-all", false, "Erase the whole flash before writing, eg. to clear the node credentials")
+	deviceFlashCmd.Flags().BoolVar(&noCompress, "no-compress", false, "Write the image uncompressed")
+	deviceFlashCmd.Flags().BoolVar(&noVerify, "no-verify", false, "Skip the MD5 verification of the flash")
+	deviceFlashCmd.Flags().BoolVar(&noReset, "no-reset", false, "Leave the board in the bootloader after writing")
+
+	return deviceFlashCmd
+}
+
+func newDeviceMonitorCmd() *cobra.Command {
+	var port, logFile string
+	var baud int
+	var noTimestamps, noColor, noHints bool
+	var deviceMonitorCmd = &cobra.Command{
+		Use:   "monitor",
+		Short: "Print the serial output of a board",
+		Long: `Print the serial output of a Wio Link or Wio Node connected over USB, each line with the time it was
+received, until Ctrl-C. The Wi-Fi, server and OTA messages of the firmware are highlighted, and common failures,
+eg. a wrong Wi-Fi password or a server rejecting the node, are explained with a hint.
+
+  wio device monitor --port /dev/ttyUSB0
+  wio device monitor --port /dev/ttyUSB0 --baud 74880 --log boot.log
+
+--log appends the output, with timestamps and hints, to a file.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("device")
+
+			m := NewMonitor(os.Stdout)
+			m.Timestamps, m.Hints = !noTimestamps, !noHints
+			m.Color = !noColor && term.IsTerminal(int(os.Stdout.Fd()))
+
+			if logFile != "" {
+				f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+				if err != nil {
+					logger.Fatal(err)
+				}
+				defer f.Close()
+				m.Log = f
+			}
+
+			p, err := esp.OpenPort(port, baud)
+			if err != nil {
+				logger.Fatalf("opening %s: %v", port, err)
+			}
+			defer p.Close()
+
+			fmt.Fprintf(os.Stderr, "Monitoring %s at %d baud, Ctrl-C to quit\n", port, baud)
+			if err := m.Run(cmd.Context(), p); err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	deviceMonitorCmd.Flags().StringVar(&port, "port", "", "Serial port of the board, eg. /dev/ttyUSB0 or COM3")
+	deviceMonitorCmd.MarkFlagRequired("port")
+	deviceMonitorCmd.Flags().IntVar(&baud, "baud", esp.DefaultBaud, "Baud rate of the serial port")
+	deviceMonitorCmd.Flags().StringVar(&logFile, "log", "", "Append the output to this file")
+	deviceMonitorCmd.Flags().BoolVar(&noTimestamps, "no-timestamps", false, "Print the lines without the time they were received")
+	deviceMonitorCmd.Flags().BoolVar(&noColor, "no-color", false, "Do not highlight the messages of the firmware")
+	deviceMonitorCmd.Flags().BoolVar(&noHints, "no-hints", false, "Do not explain the failures found in the output")
+
+	return deviceMonitorCmd
+}
@@ -0,0 +1,188 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"github.com/chzyer/readline"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/spf13/viper"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const historyFile = "device_history"
+
+const usage = `Commands:
+  version                  print the firmware version of the device (VERSION)
+  apcfg                    configure the Wi-Fi network, node credentials and server (APCFG), prompting for each field
+  history                  list the commands sent in this session with their replies and timing
+  addr [host:port]         print or change the address of the device
+  timeout [duration]       print or change the wait for a reply
+  exit                     leave the console
+Any other line is sent to the device as is, eg. VERSION.`
+
+// Console is an interactive session with a device in AP mode.
+type Console struct {
+	Addr    string
+	Timeout time.Duration
+
+	out     io.Writer
+	rl      *readline.Instance
+	history []Reply
+}
+
+func NewConsole(addr string, timeout time.Duration, out io.Writer) *Console {
+	return &Console{Addr: addr, Timeout: timeout, out: out}
+}
+
+// Run reads commands until EOF or exit. The command history is kept in device_history next to the
+// configuration file.
+func (c *Console) Run() error {
+	var history string
+	if dir, err := internal.ConfigDir(); err == nil {
+		history = filepath.Join(dir, historyFile)
+	}
+
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:          "device> ",
+		HistoryFile:     history,
+		AutoComplete:    readline.NewPrefixCompleter(readline.PcItem("version"), readline.PcItem("apcfg"), readline.PcItem("history"), readline.PcItem("addr"), readline.PcItem("timeout"), readline.PcItem("help"), readline.PcItem("exit")),
+		InterruptPrompt: "^C",
+		EOFPrompt:       "exit",
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+	c.rl = rl
+
+	fmt.Fprintf(c.out, "Sending to %s, type help for the commands\n", c.Addr)
+
+	for {
+		line, err := rl.Readline()
+		if err == readline.ErrInterrupt {
+			continue
+		} else if err != nil {
+			return nil
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if line == "exit" || line == "quit" {
+			return nil
+		}
+
+		// Ctrl-C cancels the wait for a reply and returns to the prompt
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		if err := c.Exec(ctx, line); err != nil {
+			fmt.Fprintln(c.out, "error:", err)
+		}
+		stop()
+	}
+}
+
+// Exec runs a single console command.
+func (c *Console) Exec(ctx context.Context, line string) error {
+	args := strings.Fields(line)
+
+	switch strings.ToLower(args[0]) {
+	case "help", "?":
+		fmt.Fprintln(c.out, usage)
+		return nil
+	case "history":
+		for i, r := range c.history {
+			fmt.Fprintf(c.out, "%3d  %-30s %-8s %s\n", i+1, Redact(r.Command), r.Elapsed.Round(10*time.Microsecond), r.Text)
+		}
+		return nil
+	case "addr":
+		if len(args) > 1 {
+			c.Addr = args[1]
+		}
+		fmt.Fprintln(c.out, c.Addr)
+		return nil
+	case "timeout":
+		if len(args) > 1 {
+			d, err := time.ParseDuration(args[1])
+			if err != nil {
+				return err
+			}
+			c.Timeout = d
+		}
+		fmt.Fprintln(c.out, c.Timeout)
+		return nil
+	case "apcfg":
+		if len(args) > 1 {
+			return fmt.Errorf("apcfg prompts for its fields, type a raw APCFG: line to send one as is")
+		}
+		cmd, err := c.promptAPConfig()
+		if err != nil {
+			return err
+		}
+		line = cmd
+	}
+
+	line = Expand(line)
+	r, err := Send(ctx, c.Addr, line, c.Timeout)
+	c.history = append(c.history, r)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "%s (%s)\n", r.Text, r.Elapsed.Round(10*time.Microsecond))
+	return nil
+}
+
+// promptAPConfig asks for the fields of APCFG, the server defaults to the configured one.
+func (c *Console) promptAPConfig() (string, error) {
+	fields := []struct {
+		prompt, def string
+	}{
+		{"SSID", ""},
+		{"Wi-Fi password", ""},
+		{"node key", ""},
+		{"node sn", ""},
+		{"server", viper.GetString(internal.HOST)},
+		{"server IP", viper.GetString(internal.HOST_IP)},
+	}
+
+	// the answers, the password in particular, are kept out of the history file
+	c.rl.HistoryDisable()
+	defer c.rl.HistoryEnable()
+	defer c.rl.SetPrompt("device> ")
+
+	values := make([]string, len(fields))
+	for i, f := range fields {
+		prompt := f.prompt + ": "
+		if f.def != "" {
+			prompt = fmt.Sprintf("%s [%s]: ", f.prompt, f.def)
+		}
+
+		var v string
+		if i == 1 {
+			p, err := c.rl.ReadPassword(prompt)
+			if err != nil {
+				return "", err
+			}
+			v = string(p)
+		} else {
+			c.rl.SetPrompt(prompt)
+			line, err := c.rl.Readline()
+			if err != nil {
+				return "", err
+			}
+			v = line
+		}
+		values[i] = strings.TrimSpace(v)
+		if values[i] == "" {
+			values[i] = f.def
+		}
+	}
+
+	return APConfig(values[0], values[1], values[2], values[3], values[4], values[5]), nil
+}
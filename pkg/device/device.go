@@ -0,0 +1,122 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/spf13/viper"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the wait for the reply of a device in AP mode when device_timeout is not set.
+const DefaultTimeout = 3 * time.Second
+
+// shortcuts are lower case names of the commands of the AP mode firmware.
+var shortcuts = map[string]string{
+	"version": "VERSION",
+}
+
+// Expand returns the firmware command of a shortcut, eg. VERSION for version, or the command unchanged.
+func Expand(command string) string {
+	if cmd, ok := shortcuts[strings.ToLower(strings.TrimSpace(command))]; ok {
+		return cmd
+	}
+	return command
+}
+
+// Reply is the answer of a device in AP mode to a command.
+type Reply struct {
+	Command string        `json:"command"`
+	Text    string        `json:"reply"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+}
+
+// Addr returns the UDP address of the device in AP mode: the device_addr setting or NODE_UDP_ADDR.
+func Addr() string {
+	if addr := viper.GetString(internal.DEVICE_ADDR); addr != "" {
+		return addr
+	}
+	return internal.NODE_UDP_ADDR
+}
+
+// Timeout returns the wait for the reply of the device: the device_timeout setting or DefaultTimeout.
+func Timeout() time.Duration {
+	if d := viper.GetDuration(internal.DEVICE_TIMEOUT); d > 0 {
+		return d
+	}
+	return DefaultTimeout
+}
+
+// Send sends a command to the UDP port of a device in AP mode, terminated by CRLF, and waits for its reply.
+// The device answers each command with a single datagram.
+func Send(ctx context.Context, addr, command string, timeout time.Duration) (Reply, error) {
+	r := Reply{Command: strings.TrimRight(command, "\r\n")}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return r, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return r, err
+	}
+
+	// unblock the read on Ctrl-C
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	start := time.Now()
+	if _, err := fmt.Fprint(conn, r.Command+"\r\n"); err != nil {
+		return r, err
+	}
+
+	p := make([]byte, 2048)
+	n, err := conn.Read(p)
+	r.Elapsed = time.Since(start)
+	if ctx.Err() != nil {
+		return r, ctx.Err()
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return r, fmt.Errorf("no reply from %s within %s, is this machine connected to the access point of the device?", addr, timeout)
+	} else if err != nil {
+		return r, err
+	}
+
+	r.Text = strings.TrimRight(string(p[:n]), "\r\n")
+	return r, nil
+}
+
+// APConfig is the APCFG command configuring the Wi-Fi network, the node credentials and the server of a
+// device in AP mode.
+func APConfig(ssid, pass, key, sn, server, serverIP string) string {
+	return fmt.Sprintf("APCFG: %s\t%s\t%s\t%s\t%s\t%s\t", ssid, pass, key, sn, server, serverIP)
+}
+
+// Redact hides the Wi-Fi password and the node key of an APCFG command.
+func Redact(command string) string {
+	if !strings.HasPrefix(command, "APCFG:") {
+		return command
+	}
+	fields := strings.Split(command, "\t")
+	for _, i := range []int{1, 2} {
+		if i < len(fields) && fields[i] != "" {
+			fields[i] = "********"
+		}
+	}
+	return strings.Join(fields, "\t")
+}
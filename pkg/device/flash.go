@@ -0,0 +1,106 @@
+package device
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/pkg/esp"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"time"
+)
+
+// syncRetries is the number of resets into the bootloader before giving up, each followed by a few SYNC.
+const syncRetries = 3
+
+// FlashOptions control Flash.
+type FlashOptions struct {
+	Port string
+	Baud int
+	esp.FlashOptions
+
+	// Stub is the esptool flasher stub, required for compression, verification and chip erase.
+	Stub *esp.Stub
+	// Reset restarts the device into the new firmware.
+	Reset bool
+}
+
+// Flash writes a firmware image to an ESP8266 board, eg. a Wio Link or Wio Node, over its serial bootloader,
+// drawing the progress on out.
+func Flash(ctx context.Context, logger *log.Entry, image []byte, opts FlashOptions, out io.Writer) error {
+	port, err := esp.OpenPort(opts.Port, opts.Baud)
+	if err != nil {
+		return fmt.Errorf("opening %s: %v", opts.Port, err)
+	}
+	defer port.Close()
+
+	l := esp.NewLoader(port)
+	if err := connect(ctx, logger, l); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Connected to the bootloader on %s\n", opts.Port)
+
+	if opts.Stub != nil {
+		if err := l.RunStub(opts.Stub.Segments(), opts.Stub.Entry); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Running the flasher stub")
+	} else {
+		if opts.Compress {
+			logger.Warn("The ESP8266 ROM loader can not decompress, writing uncompressed. Use --stub for compressed writes")
+			opts.Compress = false
+		}
+		if opts.Verify {
+			logger.Warn("The ESP8266 ROM loader can not compute MD5 digests, the image is not verified. Use --stub to verify it")
+			opts.Verify = false
+		}
+	}
+
+	if opts.EraseAll {
+		fmt.Fprintln(out, "Erasing the whole flash, this takes a while")
+	}
+
+	sum := md5.Sum(image)
+	fmt.Fprintf(out, "Writing %d bytes at 0x%08x (md5 %s)\n", len(image), opts.Offset, hex.EncodeToString(sum[:]))
+
+	bar := newProgressBar(out)
+	start := time.Now()
+	err = l.WriteFlash(ctx, image, opts.FlashOptions, func(stage esp.Stage, done, total int) {
+		bar.Update(string(stage), done, total)
+	})
+	bar.Done()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Wrote %d bytes in %s\n", len(image), time.Since(start).Round(10*time.Millisecond))
+	if opts.Verify {
+		fmt.Fprintln(out, "Verified the flash MD5")
+	}
+
+	if err := l.Finish(opts.Compress, opts.Reset); err != nil {
+		return err
+	}
+	if opts.Reset {
+		fmt.Fprintln(out, "Reset the device into the new firmware")
+	} else {
+		fmt.Fprintln(out, "The device stays in the bootloader, reset it to run the new firmware")
+	}
+	return nil
+}
+
+// connect resets the device into the bootloader and syncs with it. A pseudo-terminal, or an adapter without
+// DTR and RTS, can not reset the device: it must be put in bootloader mode by hand.
+func connect(ctx context.Context, logger *log.Entry, l *esp.Loader) error {
+	var err error
+	for i := 0; i < syncRetries; i++ {
+		if resetErr := l.EnterBootloader(); resetErr != nil {
+			logger.Debugf("Could not reset into the bootloader with DTR and RTS: %v", resetErr)
+		}
+		if err = l.Sync(ctx, 5); err == nil || ctx.Err() != nil {
+			return err
+		}
+		logger.Debug(err)
+	}
+	return fmt.Errorf("%v. Hold the flash button, or pull GPIO0 low, while resetting the board", err)
+}
@@ -0,0 +1,170 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"github.com/gabeduke/wio-cli-go/pkg/esp"
+	"github.com/gabeduke/wio-cli-go/pkg/esp/esptest"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"strings"
+	"testing"
+)
+
+// startBootloader runs b on a pseudo-terminal and returns the name of its slave, the port to flash.
+func startBootloader(t *testing.T, b *esptest.Bootloader) string {
+	t.Helper()
+	b.Logf = t.Logf
+
+	master, slave, err := esptest.Open()
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	t.Cleanup(func() {
+		master.Close()
+		slave.Close()
+	})
+	go b.Serve(master)
+	return slave.Name()
+}
+
+func testLogger() *log.Entry {
+	logger := log.New()
+	logger.Out = io.Discard
+	return log.NewEntry(logger)
+}
+
+func testImage(t *testing.T) []byte {
+	t.Helper()
+	image := make([]byte, 40000)
+	if _, err := rand.Read(image[:20000]); err != nil {
+		t.Fatal(err)
+	}
+	// a compressible half, like the zero filled parts of a firmware
+	copy(image[20000:], bytes.Repeat([]byte("wio link"), 2500))
+	return image
+}
+
+func testStub(t *testing.T) *esp.Stub {
+	t.Helper()
+	text := make([]byte, 7000)
+	if _, err := rand.Read(text); err != nil {
+		t.Fatal(err)
+	}
+	return &esp.Stub{Entry: 0x4010e004, Text: text, TextStart: 0x4010e000}
+}
+
+func sent(b *esptest.Bootloader, op byte) bool {
+	for _, c := range b.Commands() {
+		if c.Op == op {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFlashPlain(t *testing.T) {
+	b := esptest.New(1 << 20)
+	port := startBootloader(t, b)
+
+	image := testImage(t)
+	var out bytes.Buffer
+	opts := FlashOptions{Port: port, FlashOptions: esp.FlashOptions{Offset: 0x1000, Compress: true, Verify: true}, Reset: true}
+	if err := Flash(context.Background(), testLogger(), image, opts, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	// without the stub the image is written uncompressed and is not verified
+	if sent(b, esp.FlashDeflBegin) || sent(b, esp.SpiFlashMD5) {
+		t.Fatal("stub commands were sent to the ROM loader")
+	}
+	if !bytes.Equal(b.Flash()[0x1000:0x1000+len(image)], image) {
+		t.Fatal("the flash does not hold the image")
+	}
+	if strings.Contains(out.String(), "Verified") {
+		t.Fatalf("an unverified write is reported as verified:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "write  [##############################] 100%") {
+		t.Fatalf("no progress bar in the output:\n%s", out.String())
+	}
+}
+
+func TestFlashCompressed(t *testing.T) {
+	b := esptest.New(1 << 20)
+	port := startBootloader(t, b)
+
+	image := testImage(t)
+	var out bytes.Buffer
+	opts := FlashOptions{Port: port, FlashOptions: esp.FlashOptions{Compress: true, Verify: true, EraseAll: true}, Stub: testStub(t), Reset: true}
+	if err := Flash(context.Background(), testLogger(), image, opts, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !sent(b, esp.EraseFlash) || !sent(b, esp.FlashDeflBegin) || !sent(b, esp.SpiFlashMD5) {
+		t.Fatalf("the write did not go through the stub: %v", b.Commands())
+	}
+	flash := b.Flash()
+	if !bytes.Equal(flash[:len(image)], image) {
+		t.Fatal("the flash does not hold the image")
+	}
+	if !bytes.Equal(flash[len(image):], bytes.Repeat([]byte{0xff}, len(flash)-len(image))) {
+		t.Fatal("the flash after the image is not erased")
+	}
+	if !strings.Contains(out.String(), "Verified the flash MD5") {
+		t.Fatalf("the write is not reported as verified:\n%s", out.String())
+	}
+}
+
+func TestFlashVerifyMismatch(t *testing.T) {
+	b := esptest.New(1 << 20)
+	b.Corrupt = true
+	port := startBootloader(t, b)
+
+	opts := FlashOptions{Port: port, FlashOptions: esp.FlashOptions{Compress: true, Verify: true}, Stub: testStub(t), Reset: true}
+	err := Flash(context.Background(), testLogger(), testImage(t), opts, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "verification failed") {
+		t.Fatalf("got %v, want a verification failure", err)
+	}
+	if sent(b, esp.FlashDeflEnd) {
+		t.Fatal("the device was reset after a failed verification")
+	}
+}
+
+func TestFlashSyncFailure(t *testing.T) {
+	b := esptest.New(1 << 20)
+	b.NoSync = true
+	port := startBootloader(t, b)
+
+	err := Flash(context.Background(), testLogger(), testImage(t), FlashOptions{Port: port}, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "no reply to SYNC") || !strings.Contains(err.Error(), "GPIO0") {
+		t.Fatalf("got %v, want a sync failure with a hint", err)
+	}
+	if sent(b, esp.FlashBegin) {
+		t.Fatal("FLASH_BEGIN was sent without a sync")
+	}
+}
+
+func TestFlashFailedBlock(t *testing.T) {
+	b := esptest.New(1 << 20)
+	b.FailBlock = 5
+	port := startBootloader(t, b)
+
+	image := testImage(t)
+	var status *esp.StatusError
+	err := Flash(context.Background(), testLogger(), image, FlashOptions{Port: port}, io.Discard)
+	if !errors.As(err, &status) || status.Code != esptest.ErrWrite {
+		t.Fatalf("got %v, want a flash write error", err)
+	}
+	if !strings.Contains(err.Error(), "writing at 0x1000") {
+		t.Fatalf("the error does not locate the failed block: %v", err)
+	}
+	// the blocks before the failed one were written, the device was not reset
+	if !bytes.Equal(b.Flash()[:4*esp.RomWriteSize], image[:4*esp.RomWriteSize]) {
+		t.Fatal("the blocks before the failed one were not written")
+	}
+	if sent(b, esp.FlashEnd) {
+		t.Fatal("the device was reset after a failed write")
+	}
+}
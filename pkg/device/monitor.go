@@ -0,0 +1,209 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// idleFlush is the wait before a line without a newline, eg. a prompt, is printed.
+const idleFlush = 200 * time.Millisecond
+
+// ANSI colors of the highlighted messages.
+const (
+	colorReset  = "\x1b[0m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorRed    = "\x1b[31m"
+	colorCyan   = "\x1b[36m"
+)
+
+// Event is a kind of message of the Wio firmware.
+type Event string
+
+const (
+	EventBoot   Event = "boot"
+	EventWiFi   Event = "wifi"
+	EventServer Event = "server"
+	EventOTA    Event = "ota"
+	EventError  Event = "error"
+)
+
+var eventColors = map[Event]string{
+	EventBoot:   colorCyan,
+	EventWiFi:   colorGreen,
+	EventServer: colorGreen,
+	EventOTA:    colorYellow,
+	EventError:  colorRed,
+}
+
+// Pattern recognizes a message of the firmware, with a hint printed the first time a failure is seen.
+type Pattern struct {
+	Event Event
+	Re    *regexp.Regexp
+	Hint  string
+}
+
+// Patterns are the messages of the Wio Link and Wio Node firmware and of the ESP8266 SDK, failures first.
+var Patterns = []Pattern{
+	{EventError, regexp.MustCompile(`(?i)wrong password|auth(entication)? (fail|expire)|4-?way[ _]handshake`),
+		"The Wi-Fi password is wrong. Put the node in AP mode and configure it again with wio device send apcfg."},
+	{EventError, regexp.MustCompile(`(?i)no[ _]ap[ _]found|ssid not found|can'?t find (the )?ap|no \S+ found, reconnect`),
+		"The Wi-Fi network was not found. Check the SSID, the node only joins 2.4 GHz networks."},
+	{EventError, regexp.MustCompile(`(?i)dhcp.*(fail|timeout)`),
+		"The node joined the Wi-Fi network but got no address from its DHCP server."},
+	{EventError, regexp.MustCompile(`(?i)(dns|resolve).*(fail|error)|fail.*(dns|resolve)`),
+		"The node can not resolve the server name. Configure the server IP with wio device send apcfg or check with wio doctor."},
+	{EventError, regexp.MustCompile(`(?i)(handshake|hello).*(fail|refused|reject|timeout)|invalid (node )?(key|sn)`),
+		"The server rejected the node. Check its key and sn with wio nodes list, or register it again with wio nodes register --create."},
+	{EventError, regexp.MustCompile(`(?i)(connect|connection).*(fail|refused|timeout|lost)`),
+		"The node can not reach the server. Check the server address and IP given with APCFG and run wio doctor."},
+	{EventError, regexp.MustCompile(`(?i)ota.*(fail|error|abort)`),
+		"The firmware update failed. Retry it with wio nodes ota, or reflash the board with wio device flash."},
+	{EventError, regexp.MustCompile(`(?i)exception \(\d+\)|wdt reset|rst cause:\s*4\b|stack smashing`),
+		"The firmware crashed and the board restarted. Reflash it with wio device flash if it keeps crashing."},
+	{EventBoot, regexp.MustCompile(`(?i)rst cause|boot mode|ets \w+ +\d+ \d+`), ""},
+	{EventWiFi, regexp.MustCompile(`(?i)(wi-?fi|\bap\b|ssid).*(connected|joined)|connected with|got ip|ip address|ip:\s*\d+\.\d+\.\d+\.\d+|connecting to (wi-?fi|ap\b|ssid)`), ""},
+	{EventServer, regexp.MustCompile(`(?i)connect(ing|ed)? to (the )?server|server.*(connected|online)|handshake ok|node is online`), ""},
+	{EventOTA, regexp.MustCompile(`(?i)\bota\b|firmware update|download(ing)? firmware`), ""},
+}
+
+// Match returns the first pattern matching a line.
+func Match(line string) (Pattern, bool) {
+	for _, p := range Patterns {
+		if p.Re.MatchString(line) {
+			return p, true
+		}
+	}
+	return Pattern{}, false
+}
+
+// Monitor prints the serial output of a board line by line.
+type Monitor struct {
+	// Timestamps prefixes each line with the time it was received.
+	Timestamps bool
+	// Color highlights the known messages of the firmware.
+	Color bool
+	// Hints explains the failures recognized in the output, once each.
+	Hints bool
+	// Log receives a copy of the output, with timestamps and without colors.
+	Log io.Writer
+
+	out     io.Writer
+	hinted  map[string]bool
+	garbled int
+}
+
+func NewMonitor(out io.Writer) *Monitor {
+	return &Monitor{Timestamps: true, Hints: true, out: out, hinted: map[string]bool{}}
+}
+
+// Run copies the output of r until ctx is done. r must return no data, rather than block, when the port is
+// idle, see esp.OpenPort.
+func (m *Monitor) Run(ctx context.Context, r io.Reader) error {
+	var line []byte
+	var last time.Time
+	buf := make([]byte, 1024)
+	for {
+		if ctx.Err() != nil {
+			if len(line) > 0 {
+				m.Line(time.Now(), string(line))
+			}
+			return nil
+		}
+
+		n, err := r.Read(buf)
+		now := time.Now()
+		if n > 0 {
+			last = now
+			line = append(line, buf[:n]...)
+			for {
+				i := bytes.IndexByte(line, '\n')
+				if i < 0 {
+					break
+				}
+				m.Line(now, string(bytes.TrimRight(line[:i], "\r")))
+				line = line[i+1:]
+			}
+		} else if len(line) > 0 && now.Sub(last) > idleFlush {
+			m.Line(now, string(line))
+			line = nil
+		}
+
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				m.Line(now, string(line))
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Line prints a line received at t, and the hint of a recognized failure.
+func (m *Monitor) Line(t time.Time, line string) {
+	var prefix string
+	if m.Timestamps {
+		prefix = t.Format("15:04:05.000") + " "
+	}
+
+	p, known := Match(line)
+	if m.Log != nil {
+		fmt.Fprintf(m.Log, "%s%s\n", prefix, line)
+	}
+
+	if m.Color && known {
+		fmt.Fprintf(m.out, "%s%s%s%s\n", prefix, eventColors[p.Event], line, colorReset)
+	} else {
+		fmt.Fprintf(m.out, "%s%s\n", prefix, line)
+	}
+
+	if !m.Hints {
+		return
+	}
+	if known && p.Hint != "" {
+		m.hint(p.Hint)
+	}
+	if garbled(line) {
+		m.garbled++
+		if m.garbled >= 3 {
+			m.hint("The output is garbled, check --baud. The Wio firmware logs at 115200, the ESP8266 ROM prints its boot messages at 74880.")
+		}
+	}
+}
+
+func (m *Monitor) hint(hint string) {
+	if m.hinted[hint] {
+		return
+	}
+	m.hinted[hint] = true
+
+	msg := "hint: " + hint
+	if m.Log != nil {
+		fmt.Fprintln(m.Log, msg)
+	}
+	if m.Color {
+		msg = colorYellow + msg + colorReset
+	}
+	fmt.Fprintln(m.out, msg)
+}
+
+// garbled reports whether most of a line is not printable, as when the baud rate is wrong.
+func garbled(line string) bool {
+	if len(line) < 8 {
+		return false
+	}
+	bad := 0
+	for _, r := range line {
+		if r == utf8.RuneError || (r < 0x20 && r != '\t') || r == 0x7f {
+			bad++
+		}
+	}
+	return bad*3 > utf8.RuneCountInString(line)
+}
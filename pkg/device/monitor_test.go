@@ -0,0 +1,285 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"github.com/gabeduke/wio-cli-go/pkg/esp"
+	"github.com/gabeduke/wio-cli-go/pkg/esp/esptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testdata = "testdata"
+
+var timestamp = regexp.MustCompile(`^\d\d:\d\d:\d\d\.\d{3} `)
+
+// syncBuffer is written by the monitor and read by the test.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func readLog(t *testing.T, name string) []string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(testdata, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+}
+
+// monitorTest runs a Monitor on the slave of a pseudo-terminal, the test writes the output of the board on
+// master.
+type monitorTest struct {
+	t       *testing.T
+	m       *Monitor
+	out     *syncBuffer
+	log     *syncBuffer
+	master  *os.File
+	cancel  context.CancelFunc
+	done    chan error
+	stopped bool
+}
+
+func startMonitor(t *testing.T, color bool) *monitorTest {
+	t.Helper()
+	master, slave, err := esptest.Open()
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	port, err := esp.OpenPort(slave.Name(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mt := &monitorTest{t: t, out: &syncBuffer{}, log: &syncBuffer{}, master: master, done: make(chan error, 1)}
+	mt.m = NewMonitor(mt.out)
+	mt.m.Color = color
+	mt.m.Log = mt.log
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mt.cancel = cancel
+	go func() { mt.done <- mt.m.Run(ctx, port) }()
+
+	t.Cleanup(func() {
+		mt.stop()
+		port.Close()
+		master.Close()
+		slave.Close()
+	})
+	return mt
+}
+
+// boot plays a testdata log through the emulated board.
+func (mt *monitorTest) boot(name string) {
+	b := esptest.New(0)
+	b.Firmware = readLog(mt.t, name)
+	b.LineDelay = time.Millisecond
+	b.Boot(mt.master)
+}
+
+// waitFor waits until the output contains s.
+func (mt *monitorTest) waitFor(s string) {
+	mt.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(mt.out.String(), s) {
+		if time.Now().After(deadline) {
+			mt.t.Fatalf("%q was not printed, got:\n%s", s, mt.out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (mt *monitorTest) stop() {
+	if mt.stopped {
+		return
+	}
+	mt.stopped = true
+	mt.cancel()
+	if err := <-mt.done; err != nil {
+		mt.t.Error(err)
+	}
+}
+
+func TestMonitorTimestampsAndHints(t *testing.T) {
+	mt := startMonitor(t, false)
+	mt.boot("wrong-password.log")
+	lines := readLog(t, "wrong-password.log")
+	mt.waitFor(lines[len(lines)-1])
+	mt.stop()
+
+	out := mt.out.String()
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		if !strings.HasPrefix(line, "hint: ") && !timestamp.MatchString(line) {
+			t.Errorf("no timestamp on %q", line)
+		}
+	}
+	// the failure is seen twice, its hint is printed once
+	if n := strings.Count(out, "hint: The Wi-Fi password is wrong"); n != 1 {
+		t.Errorf("the hint is printed %d times:\n%s", n, out)
+	}
+	if strings.Count(out, "hint: ") != 1 {
+		t.Errorf("unexpected hints:\n%s", out)
+	}
+	if strings.Contains(out, "\x1b[") {
+		t.Errorf("colors without Color:\n%q", out)
+	}
+	if mt.log.String() != out {
+		t.Errorf("the log differs from the output:\n%s", mt.log.String())
+	}
+}
+
+func TestMonitorColor(t *testing.T) {
+	mt := startMonitor(t, true)
+	mt.boot("server-rejected.log")
+	lines := readLog(t, "server-rejected.log")
+	mt.waitFor(lines[len(lines)-1])
+	mt.stop()
+
+	out := mt.out.String()
+	for _, want := range []string{
+		colorGreen + "WiFi connected, got IP 192.168.1.23" + colorReset,
+		colorGreen + "Connecting to server 54.223.12.10:8000" + colorReset,
+		colorRed + "Handshake failed, the server rejected the node key" + colorReset,
+		colorYellow + "hint: The server rejected the node.",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q is not highlighted:\n%q", want, out)
+		}
+	}
+	if strings.Contains(out, "\x1b[32mWio Link firmware") || !strings.Contains(out, " Wio Link firmware 1.2\n") {
+		t.Errorf("an unknown message is highlighted:\n%q", out)
+	}
+	for _, hint := range []string{"hint: The node can not resolve", "hint: The server rejected", "hint: The node can not reach"} {
+		if n := strings.Count(out, hint); n != 1 {
+			t.Errorf("%q is printed %d times", hint, n)
+		}
+	}
+
+	// the log gets the same lines without the colors
+	log := mt.log.String()
+	if strings.Contains(log, "\x1b") {
+		t.Errorf("ANSI codes in the log:\n%q", log)
+	}
+	if !strings.Contains(log, " Handshake failed, the server rejected the node key\n") || !strings.Contains(log, "hint: The server rejected the node.") {
+		t.Errorf("the log misses lines:\n%s", log)
+	}
+}
+
+func TestMonitorIdleFlush(t *testing.T) {
+	mt := startMonitor(t, false)
+
+	// a line without a newline is printed once the port is idle
+	mt.master.Write([]byte("Press a key to enter the setup> "))
+	mt.waitFor("Press a key to enter the setup> \n")
+	mt.master.Write([]byte("ready\r\n"))
+	mt.waitFor(" ready\n")
+	mt.stop()
+
+	lines := strings.Split(strings.TrimRight(mt.out.String(), "\n"), "\n")
+	if len(lines) != 2 || !timestamp.MatchString(lines[1]) {
+		t.Fatalf("the partial line and the next one are not printed separately:\n%s", mt.out.String())
+	}
+}
+
+func TestMonitorGarbled(t *testing.T) {
+	mt := startMonitor(t, false)
+
+	// the output of the board at the wrong baud rate
+	garbage := append(bytes.Repeat([]byte{0x80, 0xfe, 0x01}, 8), '\n')
+	for i := 0; i < 2; i++ {
+		mt.master.Write(garbage)
+	}
+	mt.master.Write([]byte("marker\n"))
+	mt.waitFor("marker")
+	if strings.Contains(mt.out.String(), "hint:") {
+		t.Fatalf("hint after 2 garbled lines:\n%q", mt.out.String())
+	}
+
+	for i := 0; i < 3; i++ {
+		mt.master.Write(garbage)
+	}
+	mt.master.Write([]byte("end\n"))
+	mt.waitFor(" end\n")
+	mt.stop()
+
+	if n := strings.Count(mt.out.String(), "hint: The output is garbled, check --baud."); n != 1 {
+		t.Fatalf("the baud rate hint is printed %d times:\n%q", n, mt.out.String())
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	// lines of the testdata logs, and a few more, with their event and the start of their hint
+	tests := []struct {
+		file, line string
+		event      Event
+		hint       string
+	}{
+		{"boot.log", " ets Jan  8 2013,rst cause:2, boot mode:(3,6)", EventBoot, ""},
+		{"boot.log", "Connecting to WiFi home...", EventWiFi, ""},
+		{"boot.log", "connected with home, channel 6", EventWiFi, ""},
+		{"boot.log", "ip:192.168.1.23,mask:255.255.255.0,gw:192.168.1.1", EventWiFi, ""},
+		{"boot.log", "WiFi connected, got IP 192.168.1.23", EventWiFi, ""},
+		{"boot.log", "Connecting to server us.wio.seeed.io:8000", EventServer, ""},
+		{"boot.log", "Handshake ok, the node is online", EventServer, ""},
+		{"boot.log", "OTA: downloading firmware from us.wio.seeed.io", EventOTA, ""},
+		{"boot.log", "OTA: done, rebooting", EventOTA, ""},
+		{"wrong-password.log", "WiFi disconnected, reason 15 (4WAY_HANDSHAKE_TIMEOUT)", EventError, "The Wi-Fi password is wrong"},
+		{"no-network.log", "no office found, reconnect after 1s", EventError, "The Wi-Fi network was not found"},
+		{"no-network.log", "WiFi disconnected, reason 201 (NO_AP_FOUND)", EventError, "The Wi-Fi network was not found"},
+		{"server-rejected.log", "DNS lookup failed for us.wio.seeed.io, using the server IP", EventError, "The node can not resolve the server name"},
+		{"server-rejected.log", "Handshake failed, the server rejected the node key", EventError, "The server rejected the node"},
+		{"server-rejected.log", "Connection to server lost, reconnecting in 5s", EventError, "The node can not reach the server"},
+		{"crash.log", "OTA: download failed, error -1", EventError, "The firmware update failed"},
+		{"crash.log", "Exception (28):", EventError, "The firmware crashed"},
+		{"crash.log", "Soft WDT reset", EventError, "The firmware crashed"},
+		{"crash.log", " ets Jan  8 2013,rst cause:4, boot mode:(3,6)", EventError, "The firmware crashed"},
+		{"", "DHCP timeout, no address", EventError, "The node joined the Wi-Fi network but got no address"},
+		{"", "Wrong password for home", EventError, "The Wi-Fi password is wrong"},
+		{"", "AP home joined", EventWiFi, ""},
+	}
+
+	logs := map[string]string{}
+	for _, tt := range tests {
+		if tt.file != "" {
+			if _, ok := logs[tt.file]; !ok {
+				logs[tt.file] = strings.Join(readLog(t, tt.file), "\n") + "\n"
+			}
+			if !strings.Contains(logs[tt.file], tt.line+"\n") {
+				t.Errorf("%q is not a line of %s", tt.line, tt.file)
+			}
+		}
+
+		p, ok := Match(tt.line)
+		if !ok {
+			t.Errorf("%q is not recognized", tt.line)
+			continue
+		}
+		if p.Event != tt.event || !strings.HasPrefix(p.Hint, tt.hint) || (tt.hint == "") != (p.Hint == "") {
+			t.Errorf("%q matched %s with hint %q, want %s with hint %q", tt.line, p.Event, p.Hint, tt.event, tt.hint)
+		}
+	}
+
+	for _, line := range []string{"Wio Link firmware 1.2", "scandone", "state: 0 -> 2 (b0)", "dhcp client start...", "load 0x4010f000, len 1384, room 16", "heap snapshot: 2 clients connected", "connecting to apache"} {
+		if p, ok := Match(line); ok {
+			t.Errorf("%q matched %s", line, p.Event)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package device
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+const barWidth = 30
+
+// progressBar redraws a single line like
+//
+//	write  [##########--------------------]  33% 128.0/384.0 KiB
+type progressBar struct {
+	out   io.Writer
+	label string
+	last  int
+}
+
+func newProgressBar(out io.Writer) *progressBar {
+	return &progressBar{out: out, last: -1}
+}
+
+// Update redraws the bar, a new label starts a new line.
+func (p *progressBar) Update(label string, done, total int) {
+	if total <= 0 {
+		return
+	}
+	if label != p.label {
+		p.Done()
+		p.label, p.last = label, -1
+	}
+
+	percent := done * 100 / total
+	if percent == p.last {
+		return
+	}
+	p.last = percent
+
+	filled := barWidth * done / total
+	fmt.Fprintf(p.out, "\r%-7s[%s%s] %3d%% %.1f/%.1f KiB", label, strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), percent, float64(done)/1024, float64(total)/1024)
+}
+
+// Done ends the line of the current bar.
+func (p *progressBar) Done() {
+	if p.label != "" {
+		fmt.Fprintln(p.out)
+		p.label = ""
+	}
+}
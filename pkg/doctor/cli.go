@@ -0,0 +1,33 @@
+package doctor
+
+import (
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func NewDoctorCmd() *cobra.Command {
+	var output string
+	var doctorCmd = &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose the configuration and the connection to the server",
+		Long: `Check the configuration file, the server address, DNS, TCP and TLS reachability, the token, the clock and,
+when connected to the access point of a device, its UDP port. Each check passes, warns or fails with a hint on how
+to fix it. The command exits with status 1 when a check failed.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("doctor")
+			report := Run(cmd.Context())
+			if err := report.Print(os.Stdout, output); err != nil {
+				logger.Fatal(err)
+			}
+			if report.Failed() {
+				os.Exit(1)
+			}
+		},
+	}
+
+	doctorCmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+
+	return doctorCmd
+}
@@ -0,0 +1,455 @@
+package doctor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/device"
+	"github.com/spf13/viper"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type Status string
+
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+	Skip Status = "skip"
+)
+
+// Check is the outcome of one diagnostic, with a hint on how to fix it when it did not pass.
+type Check struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// Report holds the checks in the order they ran.
+type Report []Check
+
+// Failed reports whether any check failed.
+func (r Report) Failed() bool {
+	for _, c := range r {
+		if c.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the report as a table or, with format json, as JSON.
+func (r Report) Print(out io.Writer, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	counts := map[Status]int{}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, c := range r {
+		counts[c.Status]++
+		fmt.Fprintf(w, "%s\t%s\t%s\n", strings.ToUpper(string(c.Status)), c.Name, c.Message)
+		if c.Hint != "" && c.Status != Pass {
+			fmt.Fprintf(w, "\t\t-> %s\n", c.Hint)
+		}
+	}
+	fmt.Fprintf(w, "\n%d passed, %d warnings, %d failed, %d skipped\n", counts[Pass], counts[Warn], counts[Fail], counts[Skip])
+	return w.Flush()
+}
+
+// state is shared by the checks, later checks are skipped when the ones they depend on failed.
+type state struct {
+	server   *url.URL
+	resolved []string
+	reached  bool
+	date     time.Time
+}
+
+// Run runs every check in order.
+func Run(ctx context.Context) Report {
+	s := &state{}
+	checks := []func(context.Context, *state) Check{
+		checkConfig,
+		checkServer,
+		checkDNS,
+		checkPinnedIP,
+		checkTCP,
+		checkTLS,
+		checkToken,
+		checkClock,
+		checkDevice,
+	}
+
+	var report Report
+	for _, check := range checks {
+		report = append(report, check(ctx, s))
+	}
+	return report
+}
+
+func checkConfig(ctx context.Context, s *state) Check {
+	c := Check{Name: "config file"}
+
+	path, err := internal.ConfigFile()
+	if err != nil {
+		c.Status, c.Message = Fail, err.Error()
+		return c
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		c.Status, c.Message = Warn, "no configuration file at "+path
+		c.Hint = "run `wio user configure` or pass --config"
+		return c
+	} else if err != nil {
+		c.Status, c.Message = Fail, err.Error()
+		c.Hint = "check the permissions of " + path
+		return c
+	}
+
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		c.Status, c.Message = Fail, fmt.Sprintf("%s can not be parsed: %v", path, err)
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			line := strings.Count(string(data[:syntax.Offset]), "\n") + 1
+			c.Message = fmt.Sprintf("%s can not be parsed, line %d: %v", path, line, err)
+		}
+		c.Hint = "fix the JSON syntax or move the file away and run `wio user configure`"
+		return c
+	}
+
+	c.Status, c.Message = Pass, path
+	if p := viper.GetString(internal.PROFILE); p != "" {
+		c.Message += fmt.Sprintf(" (profile %s)", p)
+	}
+	return c
+}
+
+func checkServer(ctx context.Context, s *state) Check {
+	c := Check{Name: "server address"}
+
+	server := viper.GetString(internal.HOST)
+	if server == "" {
+		c.Status, c.Message = Fail, "mserver is not set"
+		c.Hint = "run `wio user configure`"
+		return c
+	}
+
+	u, err := url.Parse(server)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		c.Status, c.Message = Fail, fmt.Sprintf("invalid server address %q", server)
+		c.Hint = "use a URL such as https://wio.example.com"
+		return c
+	}
+
+	s.server = u
+	c.Status, c.Message = Pass, server
+	return c
+}
+
+func checkDNS(ctx context.Context, s *state) Check {
+	c := Check{Name: "dns"}
+	if s.server == nil {
+		c.Status, c.Message = Skip, "no server address"
+		return c
+	}
+
+	host := s.server.Hostname()
+	if net.ParseIP(host) != nil {
+		s.resolved = []string{host}
+		c.Status, c.Message = Pass, host+" is an IP address"
+		return c
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		c.Status, c.Message = Fail, err.Error()
+		c.Hint = "check your DNS settings, or pin the server address with mserver_ip or --resolve"
+		if _, pinned, _ := internal.PinnedIP(host); pinned {
+			c.Status = Warn
+			c.Hint = "the pinned server address is used instead"
+		}
+		return c
+	}
+
+	s.resolved = addrs
+	c.Status, c.Message = Pass, fmt.Sprintf("%s resolves to %s", host, strings.Join(addrs, ", "))
+	return c
+}
+
+func checkPinnedIP(ctx context.Context, s *state) Check {
+	c := Check{Name: "pinned address"}
+	if s.server == nil {
+		c.Status, c.Message = Skip, "no server address"
+		return c
+	}
+
+	host := s.server.Hostname()
+	ip, pinned, err := internal.PinnedIP(host)
+	if err != nil {
+		c.Status, c.Message = Fail, err.Error()
+		c.Hint = "set mserver_ip to an IP address"
+		return c
+	}
+	if !pinned {
+		c.Status, c.Message = Skip, "mserver_ip is not set, the server address is resolved with DNS"
+		return c
+	}
+
+	if s.resolved == nil {
+		c.Status, c.Message = Warn, fmt.Sprintf("%s is pinned to %s, DNS could not confirm it", host, ip)
+		return c
+	}
+	for _, a := range s.resolved {
+		if net.ParseIP(a).Equal(net.ParseIP(ip)) {
+			c.Status, c.Message = Pass, fmt.Sprintf("%s is pinned to %s, matching DNS", host, ip)
+			return c
+		}
+	}
+
+	c.Status, c.Message = Warn, fmt.Sprintf("%s is pinned to %s but DNS resolves it to %s", host, ip, strings.Join(s.resolved, ", "))
+	c.Hint = "if the server moved, update mserver_ip with `wio user configure`"
+	return c
+}
+
+// address returns the host and port the API client connects to.
+func (s *state) address() string {
+	host := s.server.Hostname()
+	if ip, pinned, _ := internal.PinnedIP(host); pinned {
+		host = ip
+	}
+
+	port := s.server.Port()
+	if port == "" {
+		port = "80"
+		if s.server.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func checkTCP(ctx context.Context, s *state) Check {
+	c := Check{Name: "tcp"}
+	if s.server == nil {
+		c.Status, c.Message = Skip, "no server address"
+		return c
+	}
+	if p := viper.GetString(internal.PROXY); p != "" {
+		c.Status, c.Message = Skip, "connections go through the proxy "+p
+		return c
+	}
+
+	addr := s.address()
+	d := net.Dialer{Timeout: 5 * time.Second}
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		c.Status, c.Message = Fail, err.Error()
+		c.Hint = "check that the server is running and that no firewall blocks " + addr
+		return c
+	}
+	conn.Close()
+
+	s.reached = true
+	c.Status, c.Message = Pass, fmt.Sprintf("connected to %s in %s", addr, time.Since(start).Round(10*time.Microsecond))
+	return c
+}
+
+func checkTLS(ctx context.Context, s *state) Check {
+	c := Check{Name: "tls"}
+	if s.server == nil {
+		c.Status, c.Message = Skip, "no server address"
+		return c
+	}
+	if s.server.Scheme != "https" {
+		c.Status, c.Message = Warn, "the server uses plain HTTP, the token is sent unencrypted"
+		c.Hint = "use an https:// server address"
+		return c
+	}
+	if !s.reached {
+		c.Status, c.Message = Skip, "the server was not reached"
+		return c
+	}
+
+	config, err := internal.TLSConfig()
+	if err != nil {
+		c.Status, c.Message = Fail, err.Error()
+		c.Hint = "check the ca_bundle, client_cert and client_key settings"
+		return c
+	}
+	config.ServerName = s.server.Hostname()
+
+	d := tls.Dialer{NetDialer: &net.Dialer{Timeout: 5 * time.Second}, Config: config}
+	conn, err := d.DialContext(ctx, "tcp", s.address())
+	if err != nil {
+		c.Status, c.Message = Fail, err.Error()
+		var unknown x509.UnknownAuthorityError
+		var invalid x509.CertificateInvalidError
+		var hostname x509.HostnameError
+		switch {
+		case errors.As(err, &unknown):
+			c.Hint = "the server certificate is signed by a private CA, set ca_bundle to its PEM file"
+		case errors.As(err, &invalid):
+			c.Hint = "the server certificate is expired or not yet valid, check the clock of this machine and of the server"
+		case errors.As(err, &hostname):
+			c.Hint = "the server certificate does not cover " + s.server.Hostname() + ", check mserver"
+		case strings.Contains(err.Error(), "certificate required"):
+			c.Hint = "the server requires a client certificate, set client_cert and client_key"
+		}
+		return c
+	}
+	defer conn.Close()
+
+	if config.InsecureSkipVerify {
+		c.Status, c.Message = Warn, "certificate verification is disabled"
+		c.Hint = "remove insecure_skip_verify and set ca_bundle instead"
+		return c
+	}
+
+	cert := conn.(*tls.Conn).ConnectionState().PeerCertificates[0]
+	c.Status = Pass
+	c.Message = fmt.Sprintf("certificate of %s issued by %s, valid until %s", s.server.Hostname(), cert.Issuer.CommonName, cert.NotAfter.Format("2006-01-02"))
+	if time.Until(cert.NotAfter) < 14*24*time.Hour {
+		c.Status = Warn
+		c.Hint = "the server certificate expires soon, renew it"
+	}
+	return c
+}
+
+func checkToken(ctx context.Context, s *state) Check {
+	c := Check{Name: "token"}
+	if s.server == nil {
+		c.Status, c.Message = Skip, "no server address"
+		return c
+	}
+	token := viper.GetString(internal.TOKEN)
+	if token == "" {
+		c.Status, c.Message = Fail, "not logged in"
+		c.Hint = "run `wio login`"
+		return c
+	}
+
+	ep := *s.server
+	ep.Path = "/v1/nodes/list"
+	req, err := http.NewRequest("GET", ep.String(), nil)
+	if err != nil {
+		c.Status, c.Message = Fail, err.Error()
+		return c
+	}
+	req.Header.Add("Authorization", "token "+token)
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := internal.Do(ctx, req)
+	if err != nil {
+		c.Status, c.Message = Fail, err.Error()
+		c.Hint = "the server could not be reached with the configured TLS and proxy settings"
+		return c
+	}
+	defer resp.Body.Close()
+
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		s.date = date
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		var list struct {
+			Nodes []json.RawMessage `json:"nodes"`
+		}
+		json.NewDecoder(resp.Body).Decode(&list)
+		c.Status, c.Message = Pass, fmt.Sprintf("the token is valid, %d nodes in the account", len(list.Nodes))
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		c.Status, c.Message = Fail, "the token was rejected: "+resp.Status
+		c.Hint = "run `wio login` to get a new token"
+	default:
+		c.Status, c.Message = Fail, "unexpected response: "+resp.Status
+		c.Hint = "check that mserver points at a Wio server"
+	}
+	return c
+}
+
+func checkClock(ctx context.Context, s *state) Check {
+	c := Check{Name: "clock"}
+	if s.date.IsZero() {
+		c.Status, c.Message = Skip, "the server time is unknown"
+		return c
+	}
+
+	skew := time.Since(s.date).Round(time.Second)
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+
+	c.Message = fmt.Sprintf("the local clock is %s off the server", skew)
+	switch {
+	case abs <= 30*time.Second:
+		c.Status = Pass
+	case abs <= 5*time.Minute:
+		c.Status = Warn
+		c.Hint = "enable time synchronisation (NTP) on this machine"
+	default:
+		c.Status = Fail
+		c.Hint = "certificates and schedules depend on the clock, enable time synchronisation (NTP)"
+	}
+	return c
+}
+
+// checkDevice talks to the UDP port of a device in AP mode, when this machine is on the device network. The
+// device_addr and device_timeout settings are used like in 'wio device send'.
+func checkDevice(ctx context.Context, s *state) Check {
+	c := Check{Name: "device ap"}
+	addr := device.Addr()
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		c.Status, c.Message = Fail, err.Error()
+		return c
+	}
+	_, network, err := net.ParseCIDR(host + "/24")
+	if err != nil {
+		c.Status, c.Message = Fail, fmt.Sprintf("%s is not an IP address", host)
+		return c
+	}
+
+	connected := false
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && network.Contains(ipnet.IP) {
+			connected = true
+		}
+	}
+	if !connected {
+		c.Status, c.Message = Skip, "not connected to the access point of a device"
+		return c
+	}
+
+	reply, err := device.Send(ctx, addr, "VERSION", device.Timeout())
+	if err != nil {
+		c.Status, c.Message = Fail, err.Error()
+		c.Hint = "hold the func button for 5 seconds until the LED breathes to enter AP mode"
+		return c
+	}
+
+	c.Status, c.Message = Pass, fmt.Sprintf("device at %s replied %q", addr, strings.TrimSpace(reply.Text))
+	return c
+}
@@ -0,0 +1,137 @@
+package drivers
+
+import (
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/boards"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var ttl time.Duration
+var refresh bool
+
+func NewDriversCmd() *cobra.Command {
+	var driversCmd = &cobra.Command{
+		Use:     "drivers",
+		Short:   "Browse the Grove driver catalog",
+		Aliases: []string{"driver"},
+		Long: `Browse the Grove drivers supported by the server. The catalog is cached in drivers.json next to the
+configuration file and revalidated with the server once the cache is older than --ttl.`,
+	}
+
+	driversCmd.PersistentFlags().DurationVar(&ttl, "ttl", 24*time.Hour, "How long the cached catalog is used before revalidating it")
+	driversCmd.PersistentFlags().BoolVar(&refresh, "refresh", false, "Download the catalog even if the cache is fresh")
+
+	driversCmd.AddCommand(newDriversListCmd())
+	driversCmd.AddCommand(newDriversSearchCmd())
+	driversCmd.AddCommand(newDriversShowCmd())
+
+	return driversCmd
+}
+
+func newDriversListCmd() *cobra.Command {
+	var iface string
+	var driversListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the Grove drivers",
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("drivers")
+			drivers, err := Catalog(cmd.Context(), logger, ttl, refresh)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			var filtered []Driver
+			for _, d := range drivers {
+				if iface == "" || strings.EqualFold(d.InterfaceType, iface) {
+					filtered = append(filtered, d)
+				}
+			}
+			printTable(os.Stdout, filtered)
+		},
+	}
+
+	driversListCmd.Flags().StringVar(&iface, "interface", "", `Only list drivers of an interface type: "GPIO", "ANALOG", "I2C", "UART"`)
+
+	return driversListCmd
+}
+
+func newDriversSearchCmd() *cobra.Command {
+	var driversSearchCmd = &cobra.Command{
+		Use:   "search <term>",
+		Short: "Search Grove drivers by class name, Grove name or SKU",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("drivers")
+			drivers, err := Catalog(cmd.Context(), logger, ttl, refresh)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			printTable(os.Stdout, Search(drivers, args[0]))
+		},
+	}
+
+	return driversSearchCmd
+}
+
+func newDriversShowCmd() *cobra.Command {
+	var driversShowCmd = &cobra.Command{
+		Use:   "show <class name>",
+		Short: "Show the methods, events and compatible ports of a Grove driver",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("drivers")
+			drivers, err := Catalog(cmd.Context(), logger, ttl, refresh)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			d, err := Find(drivers, args[0])
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			fmt.Printf("Class name:  %s\n", d.ClassName)
+			fmt.Printf("Grove name:  %s\n", d.GroveName)
+			fmt.Printf("SKU:         %s\n", d.SKU)
+			fmt.Printf("Interface:   %s\n", d.InterfaceType)
+			fmt.Printf("Reads:       %s\n", strings.Join(d.Reads(), ", "))
+			fmt.Printf("Writes:      %s\n", strings.Join(d.Writes(), ", "))
+			fmt.Printf("Events:      %s\n", strings.Join(d.EventNames(), ", "))
+			fmt.Println("Ports:")
+
+			registry, err := boards.Default()
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			ports := d.Ports(registry)
+			boards := make([]string, 0, len(ports))
+			for b := range ports {
+				boards = append(boards, b)
+			}
+			sort.Strings(boards)
+			for _, b := range boards {
+				fmt.Printf("  %-14s %s\n", b, strings.Join(ports[b], ", "))
+			}
+		},
+	}
+
+	return driversShowCmd
+}
+
+func printTable(out io.Writer, drivers []Driver) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CLASS NAME\tINTERFACE\tSKU\tGROVE NAME")
+	for _, d := range drivers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.ClassName, d.InterfaceType, d.SKU, d.GroveName)
+	}
+	w.Flush()
+}
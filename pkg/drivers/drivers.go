@@ -0,0 +1,230 @@
+package drivers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/boards"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const cacheFile = "drivers.json"
+
+// Driver is a Grove driver as described by the server's driver scanner.
+type Driver struct {
+	ID            int                    `json:"ID"`
+	ClassName     string                 `json:"ClassName"`
+	GroveName     string                 `json:"GroveName"`
+	SKU           string                 `json:"SKU"`
+	InterfaceType string                 `json:"InterfaceType"`
+	ImageURL      string                 `json:"ImageURL"`
+	Comments      string                 `json:"Comments"`
+	Outputs       map[string]interface{} `json:"Outputs"`
+	Inputs        map[string]interface{} `json:"Inputs"`
+	Events        map[string]interface{} `json:"Events"`
+}
+
+// Reads returns the sorted names of the properties which can be read.
+func (d Driver) Reads() []string {
+	return sortedKeys(d.Outputs)
+}
+
+// Writes returns the sorted names of the properties which can be written.
+func (d Driver) Writes() []string {
+	return sortedKeys(d.Inputs)
+}
+
+// EventNames returns the sorted names of the events the driver reports.
+func (d Driver) EventNames() []string {
+	return sortedKeys(d.Events)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Ports returns the ports of each board the driver can be attached to, by board server identifier.
+func (d Driver) Ports(registry *boards.Registry) map[string][]string {
+	ports := map[string][]string{}
+	for _, b := range registry.List() {
+		ports[b.ServerID] = b.PortsFor(d.InterfaceType)
+	}
+	return ports
+}
+
+// cache is the driver catalog stored on disk with the ETag of the server response.
+type cache struct {
+	Server  string    `json:"server"`
+	ETag    string    `json:"etag"`
+	Fetched time.Time `json:"fetched"`
+	Drivers []Driver  `json:"drivers"`
+}
+
+func cachePath() (string, error) {
+	dir, err := internal.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, cacheFile), nil
+}
+
+func loadCache() (cache, error) {
+	var c cache
+	path, err := cachePath()
+	if err != nil {
+		return c, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+func (c cache) save() error {
+	path, err := cachePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Catalog returns the driver catalog of the configured server. The cached copy is used while it is
+// younger than ttl, after that it is revalidated with its ETag. A stale cache is used when the server
+// can not be reached.
+func Catalog(ctx context.Context, logger *log.Entry, ttl time.Duration, refresh bool) ([]Driver, error) {
+	server := viper.GetString(internal.HOST)
+
+	c, err := loadCache()
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warnf("Ignoring driver cache: %v", err)
+	}
+	if c.Server != server {
+		c = cache{Server: server}
+	}
+
+	if !refresh && c.Drivers != nil && time.Since(c.Fetched) < ttl {
+		logger.Debug("Using cached driver catalog")
+		return c.Drivers, nil
+	}
+
+	etag := c.ETag
+	if refresh {
+		etag = ""
+	}
+
+	drivers, newEtag, err := fetch(ctx, server, etag)
+	if err != nil {
+		if c.Drivers != nil {
+			logger.Warnf("Using stale driver catalog from %s: %v", c.Fetched.Format(time.RFC3339), err)
+			return c.Drivers, nil
+		}
+		return nil, err
+	}
+
+	if drivers != nil {
+		c.Drivers = drivers
+		c.ETag = newEtag
+	} else {
+		logger.Debug("Driver catalog not modified")
+	}
+	c.Fetched = time.Now()
+
+	if err := c.save(); err != nil {
+		logger.Warnf("Unable to write driver cache: %v", err)
+	}
+
+	return c.Drivers, nil
+}
+
+// fetch downloads the catalog, it returns nil drivers when the server answers 304 Not Modified.
+func fetch(ctx context.Context, server, etag string) ([]Driver, string, error) {
+	ep, err := url.Parse(server)
+	if err != nil {
+		return nil, "", err
+	}
+	ep.Path = "/v1/scan/drivers"
+
+	req, err := http.NewRequest("GET", ep.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Add("Authorization", "token "+viper.GetString(internal.TOKEN))
+	req.Header.Add("Accept", "application/json")
+	if etag != "" {
+		req.Header.Add("If-None-Match", etag)
+	}
+
+	resp, err := internal.Do(ctx, req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to list drivers: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var drivers []Driver
+	err = json.Unmarshal(body, &drivers)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return drivers, resp.Header.Get("ETag"), nil
+}
+
+// Search returns the drivers whose class name, Grove name or SKU contains term, ignoring case.
+func Search(drivers []Driver, term string) []Driver {
+	term = strings.ToLower(term)
+	var found []Driver
+	for _, d := range drivers {
+		if strings.Contains(strings.ToLower(d.ClassName), term) ||
+			strings.Contains(strings.ToLower(d.GroveName), term) ||
+			strings.Contains(strings.ToLower(d.SKU), term) {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// Find returns the driver with the given class name, ignoring case.
+func Find(drivers []Driver, className string) (Driver, error) {
+	for _, d := range drivers {
+		if strings.EqualFold(d.ClassName, className) {
+			return d, nil
+		}
+	}
+	return Driver{}, fmt.Errorf("driver not found: %s", className)
+}
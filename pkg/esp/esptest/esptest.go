@@ -0,0 +1,367 @@
+// Package esptest emulates the serial bootloader of an ESP8266 on a pseudo-terminal, to test the flasher and
+// the serial monitor without a board.
+//
+// It emulates the ROM loader, which rejects the compressed write and MD5 commands, and the flasher stub once
+// a program was loaded in RAM with MEM_BEGIN, MEM_DATA and MEM_END.
+package esptest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/creack/pty"
+	"github.com/gabeduke/wio-cli-go/pkg/esp"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Status codes of failed commands.
+const (
+	ErrInvalid  = 0x05
+	ErrFailed   = 0x06
+	ErrChecksum = 0x07
+	ErrWrite    = 0x08
+)
+
+// Command is a request received by the bootloader, with the parameter words of its data.
+type Command struct {
+	Op     byte
+	Params []uint32
+}
+
+type write struct {
+	offset, size, blocks, blockSize uint32
+	seq                             uint32
+	compressed                      bool
+	deflated                        []byte
+}
+
+// Bootloader is the emulated ESP8266.
+type Bootloader struct {
+	// NoSync never answers SYNC, like a board not in bootloader mode.
+	NoSync bool
+	// Corrupt flips a bit of each write, to fail the MD5 verification.
+	Corrupt bool
+	// FailBlock answers a flash write error to the n-th data block, counting from 1.
+	FailBlock int
+	// Firmware is printed line by line after each reset, like the serial output of the firmware.
+	Firmware []string
+	// LineDelay is the wait between the lines of Firmware.
+	LineDelay time.Duration
+	// Logf logs the commands, eg. log.Printf or t.Logf.
+	Logf func(format string, args ...interface{})
+	// OnWrite is called with the content of the flash after each complete write.
+	OnWrite func(flash []byte)
+
+	mu       sync.Mutex
+	wmu      sync.Mutex
+	port     io.Writer
+	flash    []byte
+	stub     bool
+	write    *write
+	ram      int
+	blocks   int
+	commands []Command
+}
+
+// New returns a bootloader with size bytes of erased flash.
+func New(size int) *Bootloader {
+	return &Bootloader{flash: bytes.Repeat([]byte{0xff}, size), LineDelay: 100 * time.Millisecond}
+}
+
+// Flash returns a copy of the emulated flash.
+func (b *Bootloader) Flash() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.flash...)
+}
+
+// Commands returns the commands received so far.
+func (b *Bootloader) Commands() []Command {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Command(nil), b.commands...)
+}
+
+// Stub reports whether the flasher stub runs.
+func (b *Bootloader) Stub() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stub
+}
+
+// Open returns a pseudo-terminal pair whose slave is in raw mode, like a serial port.
+func Open() (master, slave *os.File, err error) {
+	master, slave, err = pty.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := term.MakeRaw(int(slave.Fd())); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// Serve answers the commands received on port until it fails, eg. once the master of the pseudo-terminal
+// is closed.
+func (b *Bootloader) Serve(port io.ReadWriter) error {
+	b.mu.Lock()
+	b.port = port
+	b.mu.Unlock()
+
+	r := esp.NewSlipReader(port)
+	for {
+		p, err := r.ReadPacket(time.Hour)
+		if errors.Is(err, esp.ErrTimeout) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		b.handle(p)
+	}
+}
+
+// Boot leaves the loader and prints Firmware, like a reset into the firmware.
+func (b *Bootloader) Boot(port io.Writer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.port = port
+	b.reboot()
+}
+
+func (b *Bootloader) logf(format string, args ...interface{}) {
+	if b.Logf != nil {
+		b.Logf(format, args...)
+	}
+}
+
+func (b *Bootloader) handle(p []byte) {
+	if len(p) < 8 || p[0] != 0x00 {
+		b.logf("ignoring invalid packet % x", p)
+		return
+	}
+	op := p[1]
+	size := binary.LittleEndian.Uint16(p[2:])
+	checksum := binary.LittleEndian.Uint32(p[4:])
+	data := p[8:]
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if int(size) != len(data) {
+		b.fail(op, ErrInvalid)
+		return
+	}
+
+	word := func(i int) uint32 {
+		if len(data) < 4*(i+1) {
+			return 0
+		}
+		return binary.LittleEndian.Uint32(data[4*i:])
+	}
+	cmd := Command{Op: op}
+	for i := 0; i < 4 && 4*(i+1) <= len(data); i++ {
+		cmd.Params = append(cmd.Params, word(i))
+	}
+	b.commands = append(b.commands, cmd)
+
+	switch op {
+	case esp.Sync:
+		if b.NoSync {
+			return
+		}
+		// the ROM answers SYNC several times
+		for i := 0; i < 8; i++ {
+			b.reply(op, nil)
+		}
+	case esp.FlashBegin, esp.FlashDeflBegin:
+		compressed := op == esp.FlashDeflBegin
+		if compressed && !b.stub {
+			b.fail(op, ErrInvalid)
+			return
+		}
+		w := &write{size: word(0), blocks: word(1), blockSize: word(2), offset: word(3), compressed: compressed}
+		if !compressed {
+			// the size is the erase size, the ROM writes whole blocks padded with 0xff
+			w.size = w.blocks * w.blockSize
+		}
+		if int(w.offset)+int(w.size) > len(b.flash) {
+			b.fail(op, ErrFailed)
+			return
+		}
+		b.write = w
+		b.logf("begin write of %d bytes at 0x%x in %d blocks, compressed: %v", w.size, w.offset, w.blocks, compressed)
+		b.reply(op, nil)
+	case esp.FlashData, esp.FlashDeflData:
+		if b.write == nil || b.write.compressed != (op == esp.FlashDeflData) || len(data) < 16 {
+			b.fail(op, ErrFailed)
+			return
+		}
+		block := data[16:]
+		if esp.Checksum(block) != checksum {
+			b.fail(op, ErrChecksum)
+			return
+		}
+		if word(1) != b.write.seq || b.write.seq >= b.write.blocks {
+			b.fail(op, ErrFailed)
+			return
+		}
+		b.blocks++
+		if b.blocks == b.FailBlock {
+			b.fail(op, ErrWrite)
+			return
+		}
+		if err := b.writeBlock(block); err != nil {
+			b.logf("%v", err)
+			b.fail(op, ErrWrite)
+			return
+		}
+		b.reply(op, nil)
+	case esp.FlashEnd, esp.FlashDeflEnd:
+		if op == esp.FlashDeflEnd && !b.stub {
+			b.fail(op, ErrInvalid)
+			return
+		}
+		b.write = nil
+		b.reply(op, nil)
+		if word(0) == 0 {
+			b.reboot()
+		}
+	case esp.SpiFlashMD5:
+		if !b.stub {
+			b.fail(op, ErrInvalid)
+			return
+		}
+		offset, size := word(0), word(1)
+		if int(offset)+int(size) > len(b.flash) {
+			b.fail(op, ErrFailed)
+			return
+		}
+		sum := md5.Sum(b.flash[offset : offset+size])
+		b.reply(op, sum[:])
+	case esp.EraseFlash:
+		if !b.stub {
+			b.fail(op, ErrInvalid)
+			return
+		}
+		for i := range b.flash {
+			b.flash[i] = 0xff
+		}
+		b.logf("erased the flash")
+		b.reply(op, nil)
+	case esp.MemBegin:
+		b.reply(op, nil)
+	case esp.MemData:
+		if len(data) < 16 || esp.Checksum(data[16:]) != checksum {
+			b.fail(op, ErrChecksum)
+			return
+		}
+		b.ram += len(data) - 16
+		b.reply(op, nil)
+	case esp.MemEnd:
+		b.reply(op, nil)
+		if word(0) == 0 && b.ram > 0 {
+			b.logf("running the %d bytes loaded in RAM as the flasher stub", b.ram)
+			b.stub = true
+			b.send(esp.SlipEncode(esp.StubGreeting))
+		}
+	default:
+		b.fail(op, ErrInvalid)
+	}
+}
+
+func (b *Bootloader) writeBlock(block []byte) error {
+	w := b.write
+	defer func() { w.seq++ }()
+
+	if !w.compressed {
+		pos := w.offset + w.seq*w.blockSize
+		copy(b.flash[pos:pos+w.blockSize], block)
+		if b.Corrupt {
+			b.flash[pos] ^= 0x01
+		}
+		if w.seq+1 == w.blocks {
+			b.written()
+		}
+		return nil
+	}
+
+	w.deflated = append(w.deflated, block...)
+	if w.seq+1 < w.blocks {
+		return nil
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(w.deflated))
+	if err != nil {
+		return err
+	}
+	image, err := io.ReadAll(zr)
+	if err != nil {
+		return err
+	}
+	if uint32(len(image)) != w.size {
+		return fmt.Errorf("inflated %d bytes, expected %d", len(image), w.size)
+	}
+	copy(b.flash[w.offset:], image)
+	if b.Corrupt {
+		b.flash[w.offset] ^= 0x01
+	}
+	b.written()
+	return nil
+}
+
+func (b *Bootloader) written() {
+	b.logf("wrote %d bytes at 0x%x", b.write.size, b.write.offset)
+	if b.OnWrite != nil {
+		b.OnWrite(b.flash)
+	}
+}
+
+// reboot leaves the loader, the device runs the firmware until the next connection.
+func (b *Bootloader) reboot() {
+	b.logf("rebooting into the firmware")
+	b.stub = false
+	b.write = nil
+
+	firmware, delay := b.Firmware, b.LineDelay
+	go func() {
+		for _, line := range firmware {
+			time.Sleep(delay)
+			b.send([]byte(line + "\r\n"))
+		}
+	}()
+}
+
+// send writes to the port, the replies and the firmware output are written from different goroutines.
+func (b *Bootloader) send(p []byte) {
+	b.wmu.Lock()
+	defer b.wmu.Unlock()
+	if _, err := b.port.Write(p); err != nil {
+		b.logf("%v", err)
+	}
+}
+
+func (b *Bootloader) reply(op byte, body []byte) {
+	b.respond(op, append(body, 0, 0))
+}
+
+func (b *Bootloader) fail(op byte, code byte) {
+	b.logf("command 0x%02x failed with 0x%02x", op, code)
+	b.respond(op, []byte{1, code})
+}
+
+func (b *Bootloader) respond(op byte, body []byte) {
+	p := make([]byte, 8, 8+len(body))
+	p[0] = 0x01
+	p[1] = op
+	binary.LittleEndian.PutUint16(p[2:], uint16(len(body)))
+	p = append(p, body...)
+	b.send(esp.SlipEncode(p))
+}
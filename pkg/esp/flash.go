@@ -0,0 +1,211 @@
+package esp
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Stage is the step of a flash reported to the progress callback.
+type Stage string
+
+const (
+	StageErase  Stage = "erase"
+	StageWrite  Stage = "write"
+	StageVerify Stage = "verify"
+)
+
+// Progress reports done out of total bytes of a stage.
+type Progress func(stage Stage, done, total int)
+
+// Stub is the flasher stub of esptool, loaded in RAM to add compressed writes, MD5 digests and chip erase
+// to the ROM loader.
+type Stub struct {
+	Entry     uint32 `json:"entry"`
+	Text      []byte `json:"text"`
+	TextStart uint32 `json:"text_start"`
+	Data      []byte `json:"data"`
+	DataStart uint32 `json:"data_start"`
+}
+
+// ReadStub reads a stub in the JSON format of esptool, eg. esptool/targets/stub_flasher/stub_flasher_8266.json,
+// whose text and data are base64 encoded.
+func ReadStub(path string) (*Stub, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Stub
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s is not an esptool stub: %v", path, err)
+	}
+	if len(s.Text) == 0 {
+		return nil, fmt.Errorf("%s is not an esptool stub: no text segment", path)
+	}
+	return &s, nil
+}
+
+// Segments returns the parts of the stub to load in RAM.
+func (s *Stub) Segments() []Segment {
+	segments := []Segment{{Addr: s.TextStart, Data: s.Text}}
+	if len(s.Data) > 0 {
+		segments = append(segments, Segment{Addr: s.DataStart, Data: s.Data})
+	}
+	return segments
+}
+
+// FlashOptions control WriteFlash.
+type FlashOptions struct {
+	// Offset is the flash address of the image.
+	Offset uint32
+	// Compress sends the image deflated, it requires the stub.
+	Compress bool
+	// Verify compares the MD5 digest of the flash with the image, it requires the stub.
+	Verify bool
+	// EraseAll erases the whole flash before writing, it requires the stub.
+	EraseAll bool
+}
+
+// WriteFlash writes image at opts.Offset. Without the stub the image is written uncompressed, block by
+// block, and can not be verified.
+func (l *Loader) WriteFlash(ctx context.Context, image []byte, opts FlashOptions, progress Progress) error {
+	if progress == nil {
+		progress = func(Stage, int, int) {}
+	}
+	if opts.Offset%FlashSectorSize != 0 {
+		return fmt.Errorf("offset 0x%x is not aligned to the flash sector size 0x%x", opts.Offset, FlashSectorSize)
+	}
+	if len(image) == 0 {
+		return fmt.Errorf("the image is empty")
+	}
+
+	if opts.EraseAll {
+		if err := l.EraseFlash(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if opts.Compress && l.Stub {
+		err = l.writeCompressed(ctx, image, opts.Offset, progress)
+	} else {
+		err = l.writePlain(ctx, image, opts.Offset, progress)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Verify {
+		progress(StageVerify, 0, len(image))
+		digest, err := l.FlashMD5(opts.Offset, uint32(len(image)))
+		if err != nil {
+			return err
+		}
+		want := md5.Sum(image)
+		if !bytes.Equal(digest, want[:]) {
+			return fmt.Errorf("verification failed: the flash MD5 is %s, the image MD5 is %s", hex.EncodeToString(digest), hex.EncodeToString(want[:]))
+		}
+		progress(StageVerify, len(image), len(image))
+	}
+	return nil
+}
+
+func (l *Loader) writePlain(ctx context.Context, image []byte, offset uint32, progress Progress) error {
+	blockSize := RomWriteSize
+	if l.Stub {
+		blockSize = StubWriteSize
+	}
+
+	progress(StageErase, 0, len(image))
+	if err := l.FlashBegin(uint32(len(image)), offset); err != nil {
+		return err
+	}
+	progress(StageErase, len(image), len(image))
+
+	for seq, pos := uint32(0), 0; pos < len(image); seq, pos = seq+1, pos+blockSize {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		end := pos + blockSize
+		if end > len(image) {
+			end = len(image)
+		}
+		if err := l.FlashBlock(image[pos:end], seq); err != nil {
+			return fmt.Errorf("writing at 0x%x: %w", offset+uint32(pos), err)
+		}
+		progress(StageWrite, end, len(image))
+	}
+	return nil
+}
+
+func (l *Loader) writeCompressed(ctx context.Context, image []byte, offset uint32, progress Progress) error {
+	var buf bytes.Buffer
+	w, err := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(image); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	compressed := buf.Bytes()
+	blocks := (len(compressed) + StubWriteSize - 1) / StubWriteSize
+
+	if err := l.FlashDeflBegin(uint32(len(image)), uint32(blocks), offset); err != nil {
+		return err
+	}
+
+	for seq := 0; seq < blocks; seq++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		pos, end := seq*StubWriteSize, (seq+1)*StubWriteSize
+		if end > len(compressed) {
+			end = len(compressed)
+		}
+		if err := l.FlashDeflBlock(compressed[pos:end], uint32(seq)); err != nil {
+			return fmt.Errorf("writing block %d of %d: %w", seq+1, blocks, err)
+		}
+		// report the uncompressed bytes, approximated from the compression ratio
+		progress(StageWrite, len(image)*end/len(compressed), len(image))
+	}
+	return nil
+}
+
+// Finish leaves the loader after a write. The stub requires an empty write to end in a known state, then
+// the device is reset into the firmware with RTS or, when the port has no RTS line, by the loader.
+func (l *Loader) Finish(compressed, reset bool) error {
+	if l.Stub {
+		if err := l.FlashBegin(0, 0); err != nil {
+			return err
+		}
+		var err error
+		if compressed {
+			err = l.FlashDeflFinish(false)
+		} else {
+			err = l.FlashFinish(false)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !reset {
+		return nil
+	}
+
+	if err := l.HardReset(); err == nil {
+		return nil
+	}
+	if compressed && l.Stub {
+		return l.FlashDeflFinish(true)
+	}
+	return l.FlashFinish(true)
+}
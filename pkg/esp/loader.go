@@ -0,0 +1,378 @@
+package esp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Commands of the ESP8266 ROM bootloader and of the flasher stub.
+const (
+	FlashBegin     = 0x02
+	FlashData      = 0x03
+	FlashEnd       = 0x04
+	MemBegin       = 0x05
+	MemEnd         = 0x06
+	MemData        = 0x07
+	Sync           = 0x08
+	WriteReg       = 0x09
+	ReadReg        = 0x0a
+	FlashDeflBegin = 0x10 // stub only
+	FlashDeflData  = 0x11 // stub only
+	FlashDeflEnd   = 0x12 // stub only
+	SpiFlashMD5    = 0x13 // stub only
+	EraseFlash     = 0xd0 // stub only
+)
+
+const (
+	// checksumSeed is the initial value of the XOR checksum of data packets
+	checksumSeed = 0xef
+
+	// FlashSectorSize is the erase unit of the SPI flash.
+	FlashSectorSize = 0x1000
+	// RomWriteSize is the block size of FLASH_DATA for the ROM loader.
+	RomWriteSize = 0x400
+	// StubWriteSize is the block size of FLASH_DATA and FLASH_DEFL_DATA for the stub.
+	StubWriteSize = 0x4000
+	// RamBlockSize is the block size of MEM_DATA.
+	RamBlockSize = 0x1800
+
+	defaultTimeout = 3 * time.Second
+	syncTimeout    = 100 * time.Millisecond
+	// erasing and hashing take time proportional to the size of the region
+	eraseTimeoutPerMB = 30 * time.Second
+	md5TimeoutPerMB   = 8 * time.Second
+)
+
+// SyncPayload is the data of the SYNC command, which lets the ROM detect the baud rate.
+var SyncPayload = append([]byte{0x07, 0x07, 0x12, 0x20}, bytes.Repeat([]byte{0x55}, 32)...)
+
+// StubGreeting is the packet sent by the flasher stub once it runs.
+var StubGreeting = []byte("OHAI")
+
+// Port is the serial connection to the device. Reads return no data, rather than block, once the read
+// timeout expires.
+type Port interface {
+	io.ReadWriter
+	SetReadTimeout(t time.Duration) error
+	SetDTR(dtr bool) error
+	SetRTS(rts bool) error
+}
+
+// StatusError is a failure reported by the bootloader.
+type StatusError struct {
+	Op   byte
+	Code byte
+}
+
+var statusMessages = map[byte]string{
+	0x05: "received message is invalid",
+	0x06: "failed to act on received message",
+	0x07: "invalid CRC in message",
+	0x08: "flash write error",
+	0x09: "flash read error",
+	0x0a: "flash read length error",
+	0x0b: "deflate error",
+}
+
+func (e *StatusError) Error() string {
+	msg, ok := statusMessages[e.Code]
+	if !ok {
+		msg = "unknown error"
+	}
+	return fmt.Sprintf("command 0x%02x failed: %s (0x%02x)", e.Op, msg, e.Code)
+}
+
+// Loader speaks the SLIP protocol of the ESP8266 ROM bootloader, and of the flasher stub once it was
+// uploaded with RunStub.
+type Loader struct {
+	port Port
+	r    *SlipReader
+
+	// Stub is set once the flasher stub runs, it supports compressed writes and MD5 checksums.
+	Stub bool
+}
+
+func NewLoader(port Port) *Loader {
+	return &Loader{port: port, r: NewSlipReader(port)}
+}
+
+// EnterBootloader resets the device into the ROM bootloader with the DTR and RTS lines, wired to GPIO0 and
+// EN on the Wio Link and Wio Node like on most ESP8266 boards with a USB serial adapter.
+func (l *Loader) EnterBootloader() error {
+	steps := []struct {
+		dtr, rts bool
+		wait     time.Duration
+	}{
+		{false, true, 100 * time.Millisecond}, // EN low: hold the chip in reset
+		{true, false, 50 * time.Millisecond},  // GPIO0 low, EN high: boot into the ROM loader
+		{false, false, 0},                     // release GPIO0
+	}
+	for _, s := range steps {
+		if err := l.port.SetDTR(s.dtr); err != nil {
+			return err
+		}
+		if err := l.port.SetRTS(s.rts); err != nil {
+			return err
+		}
+		time.Sleep(s.wait)
+	}
+	return nil
+}
+
+// HardReset restarts the device into the flashed firmware by pulsing EN with RTS.
+func (l *Loader) HardReset() error {
+	if err := l.port.SetRTS(true); err != nil {
+		return err
+	}
+	time.Sleep(100 * time.Millisecond)
+	return l.port.SetRTS(false)
+}
+
+// Sync establishes the connection with the ROM loader, retrying until ctx is done or attempts ran out.
+func (l *Loader) Sync(ctx context.Context, attempts int) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		_, _, err = l.command(Sync, SyncPayload, 0, syncTimeout)
+		if err == nil {
+			// the ROM answers SYNC several times, drop the extra replies
+			for {
+				if _, err := l.r.ReadPacket(syncTimeout); err != nil {
+					break
+				}
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no reply to SYNC after %d attempts, is the device in bootloader mode? %v", attempts, err)
+}
+
+// command sends a request and waits for the matching response. It returns the value field of the response
+// and its data without the status bytes.
+func (l *Loader) command(op byte, data []byte, checksum uint32, timeout time.Duration) (uint32, []byte, error) {
+	header := make([]byte, 8)
+	header[0] = 0x00
+	header[1] = op
+	binary.LittleEndian.PutUint16(header[2:], uint16(len(data)))
+	binary.LittleEndian.PutUint32(header[4:], checksum)
+
+	if _, err := l.port.Write(SlipEncode(append(header, data...))); err != nil {
+		return 0, nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, nil, fmt.Errorf("command 0x%02x: %w", op, ErrTimeout)
+		}
+
+		p, err := l.r.ReadPacket(remaining)
+		if errors.Is(err, ErrTimeout) {
+			return 0, nil, fmt.Errorf("command 0x%02x: %w", op, ErrTimeout)
+		} else if err != nil {
+			return 0, nil, err
+		}
+
+		// skip stale responses, eg. the extra SYNC replies
+		if len(p) < 8 || p[0] != 0x01 || p[1] != op {
+			continue
+		}
+
+		value := binary.LittleEndian.Uint32(p[4:])
+		body := p[8:]
+		if len(body) < 2 {
+			return 0, nil, fmt.Errorf("command 0x%02x: response without status", op)
+		}
+		status, code := body[len(body)-2], body[len(body)-1]
+		if status != 0 {
+			return value, nil, &StatusError{Op: op, Code: code}
+		}
+		return value, body[:len(body)-2], nil
+	}
+}
+
+// Checksum is the XOR checksum of the data of FLASH_DATA, FLASH_DEFL_DATA and MEM_DATA.
+func Checksum(data []byte) uint32 {
+	c := byte(checksumSeed)
+	for _, b := range data {
+		c ^= b
+	}
+	return uint32(c)
+}
+
+func params(values ...uint32) []byte {
+	p := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(p[4*i:], v)
+	}
+	return p
+}
+
+// block sends a data packet: its length, sequence number, two zero words and the data.
+func (l *Loader) block(op byte, data []byte, seq uint32, timeout time.Duration) error {
+	p := append(params(uint32(len(data)), seq, 0, 0), data...)
+	_, _, err := l.command(op, p, Checksum(data), timeout)
+	return err
+}
+
+// timeoutPerMB scales a timeout to the size of the region, with defaultTimeout as the minimum.
+func timeoutPerMB(perMB time.Duration, size uint32) time.Duration {
+	t := time.Duration(float64(perMB) * float64(size) / 1e6)
+	if t < defaultTimeout {
+		return defaultTimeout
+	}
+	return t
+}
+
+// RomEraseSize works around the ESP8266 ROM, which erases the head of a region twice: it returns the erase
+// size to pass to FLASH_BEGIN so that the size bytes at offset are erased.
+func RomEraseSize(offset, size uint32) uint32 {
+	const sectorsPerBlock = 16
+
+	numSectors := (size + FlashSectorSize - 1) / FlashSectorSize
+	startSector := offset / FlashSectorSize
+
+	headSectors := sectorsPerBlock - startSector%sectorsPerBlock
+	if numSectors < headSectors {
+		headSectors = numSectors
+	}
+
+	if numSectors < 2*headSectors {
+		return (numSectors + 1) / 2 * FlashSectorSize
+	}
+	return (numSectors - headSectors) * FlashSectorSize
+}
+
+// FlashBegin erases the region and prepares an uncompressed write of size bytes at offset.
+func (l *Loader) FlashBegin(size, offset uint32) error {
+	blockSize := uint32(RomWriteSize)
+	eraseSize := RomEraseSize(offset, size)
+	if l.Stub {
+		blockSize, eraseSize = StubWriteSize, size
+	}
+	blocks := (size + blockSize - 1) / blockSize
+
+	_, _, err := l.command(FlashBegin, params(eraseSize, blocks, blockSize, offset), 0, timeoutPerMB(eraseTimeoutPerMB, size))
+	return err
+}
+
+// FlashBlock writes an uncompressed block, padded with 0xff to the block size.
+func (l *Loader) FlashBlock(data []byte, seq uint32) error {
+	blockSize := RomWriteSize
+	if l.Stub {
+		blockSize = StubWriteSize
+	}
+	if len(data) < blockSize {
+		padded := bytes.Repeat([]byte{0xff}, blockSize)
+		copy(padded, data)
+		data = padded
+	}
+	return l.block(FlashData, data, seq, defaultTimeout)
+}
+
+// FlashFinish ends an uncompressed write. With reboot the loader runs the flashed firmware, otherwise it
+// stays in the bootloader.
+func (l *Loader) FlashFinish(reboot bool) error {
+	_, _, err := l.command(FlashEnd, params(boolWord(!reboot)), 0, defaultTimeout)
+	return err
+}
+
+// FlashDeflBegin prepares a compressed write of size uncompressed bytes at offset, sent as blocks
+// compressed blocks. The stub erases the region as it writes.
+func (l *Loader) FlashDeflBegin(size, blocks, offset uint32) error {
+	_, _, err := l.command(FlashDeflBegin, params(size, blocks, StubWriteSize, offset), 0, timeoutPerMB(eraseTimeoutPerMB, size))
+	return err
+}
+
+// FlashDeflBlock writes a block of the zlib stream.
+func (l *Loader) FlashDeflBlock(data []byte, seq uint32) error {
+	// the stub may erase and write several sectors before acknowledging a block
+	return l.block(FlashDeflData, data, seq, timeoutPerMB(eraseTimeoutPerMB, StubWriteSize*4))
+}
+
+// FlashDeflFinish ends a compressed write, see FlashFinish.
+func (l *Loader) FlashDeflFinish(reboot bool) error {
+	_, _, err := l.command(FlashDeflEnd, params(boolWord(!reboot)), 0, defaultTimeout)
+	return err
+}
+
+// EraseFlash erases the whole flash chip.
+func (l *Loader) EraseFlash() error {
+	if !l.Stub {
+		return errors.New("erasing the whole flash requires the flasher stub")
+	}
+	_, _, err := l.command(EraseFlash, nil, 0, 4*eraseTimeoutPerMB)
+	return err
+}
+
+// FlashMD5 returns the MD5 digest of a region of the flash.
+func (l *Loader) FlashMD5(offset, size uint32) ([]byte, error) {
+	if !l.Stub {
+		return nil, errors.New("the ESP8266 ROM loader can not compute MD5 digests, the flasher stub is required")
+	}
+
+	_, body, err := l.command(SpiFlashMD5, params(offset, size, 0, 0), 0, timeoutPerMB(md5TimeoutPerMB, size))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) != 16 {
+		return nil, fmt.Errorf("unexpected MD5 response of %d bytes", len(body))
+	}
+	return body, nil
+}
+
+// Segment is a part of a program loaded in RAM.
+type Segment struct {
+	Addr uint32
+	Data []byte
+}
+
+// RunStub loads the flasher stub in RAM, jumps to its entry point and waits for its greeting.
+func (l *Loader) RunStub(segments []Segment, entry uint32) error {
+	for _, s := range segments {
+		blocks := (uint32(len(s.Data)) + RamBlockSize - 1) / RamBlockSize
+		if _, _, err := l.command(MemBegin, params(uint32(len(s.Data)), blocks, RamBlockSize, s.Addr), 0, defaultTimeout); err != nil {
+			return err
+		}
+		for seq := uint32(0); seq < blocks; seq++ {
+			end := (seq + 1) * RamBlockSize
+			if end > uint32(len(s.Data)) {
+				end = uint32(len(s.Data))
+			}
+			if err := l.block(MemData, s.Data[seq*RamBlockSize:end], seq, defaultTimeout); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, _, err := l.command(MemEnd, params(boolWord(entry == 0), entry), 0, defaultTimeout); err != nil {
+		return err
+	}
+
+	p, err := l.r.ReadPacket(defaultTimeout)
+	if err != nil {
+		return fmt.Errorf("the flasher stub did not start: %v", err)
+	}
+	if !bytes.Equal(p, StubGreeting) {
+		return fmt.Errorf("the flasher stub did not start, unexpected greeting %q", p)
+	}
+
+	l.Stub = true
+	return nil
+}
+
+func boolWord(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,312 @@
+package esp_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/gabeduke/wio-cli-go/pkg/esp"
+	"github.com/gabeduke/wio-cli-go/pkg/esp/esptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	p := make([]byte, n)
+	if _, err := rand.Read(p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func testStub(t *testing.T) *esp.Stub {
+	return &esp.Stub{Entry: 0x4010e004, Text: randomBytes(t, 7000), TextStart: 0x4010e000, Data: randomBytes(t, 300), DataStart: 0x3fffeb30}
+}
+
+// connect runs b on a pseudo-terminal and returns a loader synced with it.
+func connect(t *testing.T, b *esptest.Bootloader) *esp.Loader {
+	t.Helper()
+	b.Logf = t.Logf
+
+	master, slave, err := esptest.Open()
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	go b.Serve(master)
+
+	port, err := esp.OpenPort(slave.Name(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		port.Close()
+		master.Close()
+		slave.Close()
+	})
+
+	l := esp.NewLoader(port)
+	if err := l.Sync(context.Background(), 5); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func lastCommand(t *testing.T, b *esptest.Bootloader, op byte) esptest.Command {
+	t.Helper()
+	commands := b.Commands()
+	for i := len(commands) - 1; i >= 0; i-- {
+		if commands[i].Op == op {
+			return commands[i]
+		}
+	}
+	t.Fatalf("command 0x%02x was not sent", op)
+	return esptest.Command{}
+}
+
+func TestSlipRoundTrip(t *testing.T) {
+	packet := []byte{0x01, 0xc0, 0x02, 0xdb, 0x03, 0xdb, 0xdc, 0xc0}
+	encoded := esp.SlipEncode(packet)
+	if bytes.Count(encoded, []byte{0xc0}) != 2 {
+		t.Fatalf("0xc0 is not escaped in % x", encoded)
+	}
+
+	// boot messages before the packet are skipped
+	input := append([]byte("ets Jan  8 2013,rst cause:2\r\n"), encoded...)
+	r := esp.NewSlipReader(bytes.NewReader(input))
+	got, err := r.ReadPacket(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, packet) {
+		t.Fatalf("got % x, want % x", got, packet)
+	}
+
+	if _, err := r.ReadPacket(50 * time.Millisecond); !errors.Is(err, esp.ErrTimeout) {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+}
+
+func TestSlipInvalidEscape(t *testing.T) {
+	r := esp.NewSlipReader(bytes.NewReader([]byte{0xc0, 0x01, 0xdb, 0x01, 0xc0}))
+	if _, err := r.ReadPacket(time.Second); err == nil {
+		t.Fatal("an invalid escape sequence was accepted")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want uint32
+	}{
+		{nil, 0xef},
+		{[]byte{0xef}, 0x00},
+		{[]byte{0x01, 0x02, 0x04}, 0xef ^ 0x07},
+	}
+	for _, tt := range tests {
+		if got := esp.Checksum(tt.data); got != tt.want {
+			t.Errorf("Checksum(% x) = 0x%x, want 0x%x", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestRomEraseSize(t *testing.T) {
+	// values of get_erase_size in esptool
+	tests := []struct {
+		offset, size, want uint32
+	}{
+		{0x0, 0x1000, 0x1000},
+		{0x0, 300000, 0x3a000},
+		{0x1000, 0x10000, 0x8000},
+		{0x0, 0x20000, 0x10000},
+		{0xf000, 0x2000, 0x1000},
+	}
+	for _, tt := range tests {
+		if got := esp.RomEraseSize(tt.offset, tt.size); got != tt.want {
+			t.Errorf("RomEraseSize(0x%x, 0x%x) = 0x%x, want 0x%x", tt.offset, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestReadStub(t *testing.T) {
+	stub := testStub(t)
+	data, err := json.Marshal(map[string]interface{}{
+		"entry":      stub.Entry,
+		"text":       base64.StdEncoding.EncodeToString(stub.Text),
+		"text_start": stub.TextStart,
+		"data":       base64.StdEncoding.EncodeToString(stub.Data),
+		"data_start": stub.DataStart,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "stub.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := esp.ReadStub(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, stub) {
+		t.Fatalf("ReadStub returned %+v", got)
+	}
+}
+
+func TestSyncFailure(t *testing.T) {
+	b := esptest.New(1 << 20)
+	b.NoSync = true
+
+	master, slave, err := esptest.Open()
+	if err != nil {
+		t.Skipf("no pseudo-terminal: %v", err)
+	}
+	defer master.Close()
+	defer slave.Close()
+	go b.Serve(master)
+
+	port, err := esp.OpenPort(slave.Name(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Close()
+
+	err = esp.NewLoader(port).Sync(context.Background(), 3)
+	if err == nil || !strings.Contains(err.Error(), "no reply to SYNC") {
+		t.Fatalf("got %v, want no reply to SYNC", err)
+	}
+}
+
+func TestFlashBeginROM(t *testing.T) {
+	b := esptest.New(1 << 20)
+	l := connect(t, b)
+
+	if err := l.FlashBegin(300000, 0x1000); err != nil {
+		t.Fatal(err)
+	}
+	got := lastCommand(t, b, esp.FlashBegin).Params
+	want := []uint32{esp.RomEraseSize(0x1000, 300000), 293, esp.RomWriteSize, 0x1000}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("FLASH_BEGIN %v, want %v", got, want)
+	}
+}
+
+func TestROMRejectsStubCommands(t *testing.T) {
+	b := esptest.New(1 << 20)
+	l := connect(t, b)
+
+	var status *esp.StatusError
+	err := l.FlashDeflBegin(0x1000, 1, 0)
+	if !errors.As(err, &status) || status.Code != esptest.ErrInvalid {
+		t.Fatalf("FLASH_DEFL_BEGIN on the ROM returned %v", err)
+	}
+	if _, err := l.FlashMD5(0, 0x1000); err == nil {
+		t.Fatal("FlashMD5 without the stub succeeded")
+	}
+	if err := l.EraseFlash(); err == nil {
+		t.Fatal("EraseFlash without the stub succeeded")
+	}
+}
+
+func TestWritePlainROM(t *testing.T) {
+	b := esptest.New(1 << 20)
+	l := connect(t, b)
+
+	image := randomBytes(t, 5000)
+	if err := l.WriteFlash(context.Background(), image, esp.FlashOptions{Offset: 0x2000}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	flash := b.Flash()
+	if !bytes.Equal(flash[0x2000:0x2000+len(image)], image) {
+		t.Fatal("the flash does not hold the image")
+	}
+	// the last block is padded with 0xff
+	if end := 0x2000 + 5*esp.RomWriteSize; !bytes.Equal(flash[0x2000+len(image):end], bytes.Repeat([]byte{0xff}, end-0x2000-len(image))) {
+		t.Fatal("the padding of the last block is not 0xff")
+	}
+}
+
+func TestWriteCompressedStub(t *testing.T) {
+	b := esptest.New(1 << 20)
+	l := connect(t, b)
+
+	stub := testStub(t)
+	if err := l.RunStub(stub.Segments(), stub.Entry); err != nil {
+		t.Fatal(err)
+	}
+	if !l.Stub || !b.Stub() {
+		t.Fatal("the stub does not run")
+	}
+
+	image := append(randomBytes(t, 20000), bytes.Repeat([]byte("wio"), 20000)...)
+	opts := esp.FlashOptions{Offset: 0x10000, Compress: true, Verify: true}
+	if err := l.WriteFlash(context.Background(), image, opts, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Flash()[0x10000:0x10000+len(image)], image) {
+		t.Fatal("the flash does not hold the image")
+	}
+
+	begin := lastCommand(t, b, esp.FlashDeflBegin).Params
+	if begin[0] != uint32(len(image)) || begin[2] != esp.StubWriteSize || begin[3] != 0x10000 {
+		t.Fatalf("FLASH_DEFL_BEGIN %v", begin)
+	}
+	md5 := lastCommand(t, b, esp.SpiFlashMD5).Params
+	if md5[0] != 0x10000 || md5[1] != uint32(len(image)) {
+		t.Fatalf("SPI_FLASH_MD5 %v", md5)
+	}
+
+	// the stub ends with an empty write, then resets without RTS on a pseudo-terminal
+	n := len(b.Commands())
+	if err := l.Finish(true, true); err != nil {
+		t.Fatal(err)
+	}
+	got := b.Commands()[n:]
+	want := []esptest.Command{
+		{Op: esp.FlashBegin, Params: []uint32{0, 0, esp.StubWriteSize, 0}},
+		{Op: esp.FlashDeflEnd, Params: []uint32{1}},
+		{Op: esp.FlashDeflEnd, Params: []uint32{0}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Finish sent %v, want %v", got, want)
+	}
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	b := esptest.New(1 << 20)
+	b.Corrupt = true
+	l := connect(t, b)
+
+	stub := testStub(t)
+	if err := l.RunStub(stub.Segments(), stub.Entry); err != nil {
+		t.Fatal(err)
+	}
+
+	err := l.WriteFlash(context.Background(), randomBytes(t, 10000), esp.FlashOptions{Compress: true, Verify: true}, nil)
+	if err == nil || !strings.Contains(err.Error(), "verification failed") {
+		t.Fatalf("got %v, want a verification failure", err)
+	}
+}
+
+func TestFailedBlock(t *testing.T) {
+	b := esptest.New(1 << 20)
+	b.FailBlock = 3
+	l := connect(t, b)
+
+	var status *esp.StatusError
+	err := l.WriteFlash(context.Background(), randomBytes(t, 10000), esp.FlashOptions{}, nil)
+	if !errors.As(err, &status) || status.Code != esptest.ErrWrite || status.Op != esp.FlashData {
+		t.Fatalf("got %v, want a flash write error", err)
+	}
+	if !strings.Contains(err.Error(), "writing at 0x800") {
+		t.Fatalf("the error does not locate the failed block: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package esp
+
+import (
+	"go.bug.st/serial"
+	"time"
+)
+
+// DefaultBaud is the baud rate of the ESP8266 ROM loader, also used by the Wio firmware for its logs.
+const DefaultBaud = 115200
+
+// pollInterval is the read timeout of the port, the longest a read blocks without data.
+const pollInterval = 50 * time.Millisecond
+
+// OpenPort opens a serial port, or the slave of a pseudo-terminal, in 8N1 mode. Its reads return no data
+// rather than block once pollInterval expires, as expected by SlipReader.
+func OpenPort(name string, baud int) (serial.Port, error) {
+	if baud <= 0 {
+		baud = DefaultBaud
+	}
+	port, err := serial.Open(name, &serial.Mode{BaudRate: baud})
+	if err != nil {
+		return nil, err
+	}
+	if err := port.SetReadTimeout(pollInterval); err != nil {
+		port.Close()
+		return nil, err
+	}
+	return port, nil
+}
@@ -0,0 +1,119 @@
+package esp
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// SLIP framing of the ROM bootloader: packets are delimited by 0xC0, and 0xC0 and 0xDB in the packet are
+// escaped as 0xDB 0xDC and 0xDB 0xDD.
+const (
+	slipEnd    = 0xC0
+	slipEsc    = 0xDB
+	slipEscEnd = 0xDC
+	slipEscEsc = 0xDD
+)
+
+// ErrTimeout is returned when no complete packet is received in time.
+var ErrTimeout = errors.New("timed out waiting for a packet")
+
+// SlipEncode frames a packet.
+func SlipEncode(p []byte) []byte {
+	out := make([]byte, 0, len(p)+2)
+	out = append(out, slipEnd)
+	for _, b := range p {
+		switch b {
+		case slipEnd:
+			out = append(out, slipEsc, slipEscEnd)
+		case slipEsc:
+			out = append(out, slipEsc, slipEscEsc)
+		default:
+			out = append(out, b)
+		}
+	}
+	return append(out, slipEnd)
+}
+
+// SlipReader reads SLIP packets from a port whose reads return no data, rather than block, once its read
+// timeout expires, like serial ports and the fake bootloader.
+type SlipReader struct {
+	r   io.Reader
+	buf []byte
+	pos int
+}
+
+func NewSlipReader(r io.Reader) *SlipReader {
+	return &SlipReader{r: r}
+}
+
+// ReadPacket returns the next packet received before timeout. Bytes outside of a packet, eg. the boot
+// messages of the ROM, are skipped.
+func (s *SlipReader) ReadPacket(timeout time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+
+	var packet []byte
+	inPacket, escaped := false, false
+	for {
+		b, err := s.readByte(deadline)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case !inPacket:
+			if b == slipEnd {
+				inPacket = true
+				packet = packet[:0]
+			}
+		case escaped:
+			escaped = false
+			switch b {
+			case slipEscEnd:
+				packet = append(packet, slipEnd)
+			case slipEscEsc:
+				packet = append(packet, slipEsc)
+			default:
+				return nil, errors.New("invalid SLIP escape sequence")
+			}
+		case b == slipEsc:
+			escaped = true
+		case b == slipEnd:
+			if len(packet) == 0 {
+				// two delimiters in a row, the second one starts the packet
+				continue
+			}
+			return packet, nil
+		default:
+			packet = append(packet, b)
+		}
+	}
+}
+
+func (s *SlipReader) readByte(deadline time.Time) (byte, error) {
+	for s.pos >= len(s.buf) {
+		if time.Now().After(deadline) {
+			return 0, ErrTimeout
+		}
+		if cap(s.buf) == 0 {
+			s.buf = make([]byte, 0, 4096)
+		}
+		n, err := s.r.Read(s.buf[:cap(s.buf)])
+		if err != nil && !(errors.Is(err, io.EOF) && n == 0) {
+			return 0, err
+		}
+		s.buf, s.pos = s.buf[:n], 0
+		if n == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	b := s.buf[s.pos]
+	s.pos++
+	return b, nil
+}
+
+// Reset drops the buffered input.
+func (s *SlipReader) Reset() {
+	s.buf, s.pos = s.buf[:0], 0
+}
@@ -0,0 +1,178 @@
+package fanout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/pflag"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Options control how an operation is fanned out to several targets.
+type Options struct {
+	Parallel int
+	Timeout  time.Duration
+	FailFast bool
+	Output   string
+}
+
+// AddFlags registers the fan-out flags on a command.
+func AddFlags(flags *pflag.FlagSet, opts *Options) {
+	flags.IntVar(&opts.Parallel, "parallel", 4, "Number of nodes operated on concurrently")
+	flags.DurationVar(&opts.Timeout, "node-timeout", time.Minute, "Timeout of the operation on each node")
+	flags.BoolVar(&opts.FailFast, "fail-fast", false, "Stop starting new operations after the first failure")
+	flags.StringVarP(&opts.Output, "output", "o", "table", `Summary format: "table" or "json"`)
+}
+
+// Result is the outcome of the operation on one target.
+type Result struct {
+	Name    string        `json:"name"`
+	OK      bool          `json:"ok"`
+	Skipped bool          `json:"skipped,omitempty"`
+	Latency time.Duration `json:"latency_ns"`
+	Output  interface{}   `json:"output,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// Summary holds the results in the order of the targets.
+type Summary []Result
+
+// Failed reports whether the operation failed or was skipped on any target.
+func (s Summary) Failed() bool {
+	for _, r := range s {
+		if !r.OK {
+			return true
+		}
+	}
+	return false
+}
+
+var errSkipped = errors.New("skipped after an earlier failure")
+
+// Run calls fn for every target with at most opts.Parallel calls in flight. Each call gets a context
+// derived from ctx which expires after opts.Timeout; a call still running at that point is reported as
+// timed out. With opts.FailFast targets which were not started yet are skipped after the first failure,
+// and all of them are skipped once ctx is cancelled.
+func Run[T any](ctx context.Context, targets []T, name func(T) string, opts Options, fn func(context.Context, T) (interface{}, error)) Summary {
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+
+	summary := make(Summary, len(targets))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+
+	for i, t := range targets {
+		summary[i].Name = name(t)
+
+		sem <- struct{}{}
+		if stopped(stop) || ctx.Err() != nil {
+			<-sem
+			summary[i].Skipped = true
+			summary[i].Error = errSkipped.Error()
+			if ctx.Err() != nil {
+				summary[i].Error = ctx.Err().Error()
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, t T) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			output, latency, err := call(ctx, opts.Timeout, t, fn)
+			summary[i].Latency = latency
+			summary[i].Output = output
+			if err != nil {
+				summary[i].Error = err.Error()
+				if opts.FailFast {
+					stopOnce.Do(func() { close(stop) })
+				}
+				return
+			}
+			summary[i].OK = true
+		}(i, t)
+	}
+
+	wg.Wait()
+	return summary
+}
+
+func stopped(stop chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func call[T any](parent context.Context, timeout time.Duration, t T, fn func(context.Context, T) (interface{}, error)) (interface{}, time.Duration, error) {
+	ctx := parent
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(parent, timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		output interface{}
+		err    error
+	}
+	done := make(chan result, 1)
+	start := time.Now()
+	go func() {
+		output, err := fn(ctx, t)
+		done <- result{output, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.output, time.Since(start), r.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, time.Since(start), fmt.Errorf("timed out after %s", timeout)
+		}
+		return nil, time.Since(start), ctx.Err()
+	}
+}
+
+// Print writes the summary as a table or as JSON.
+func (s Summary) Print(out io.Writer, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tSTATUS\tLATENCY\tRESULT")
+	ok := 0
+	for _, r := range s {
+		status, result := "ok", ""
+		switch {
+		case r.Skipped:
+			status, result = "skipped", r.Error
+		case !r.OK:
+			status, result = "failed", r.Error
+		default:
+			ok++
+			if r.Output != nil {
+				data, _ := json.Marshal(r.Output)
+				result = string(data)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name, status, r.Latency.Round(time.Millisecond), result)
+	}
+	fmt.Fprintf(w, "\n%d/%d succeeded\n", ok, len(s))
+	return w.Flush()
+}
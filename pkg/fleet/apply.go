@@ -0,0 +1,97 @@
+package fleet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/pkg/boards"
+	"github.com/gabeduke/wio-cli-go/pkg/drivers"
+	"github.com/gabeduke/wio-cli-go/pkg/nodes"
+	"os"
+	"time"
+)
+
+// lockInfo is written to the lock file so a teammate can see who is applying.
+type lockInfo struct {
+	User    string    `json:"user"`
+	Host    string    `json:"host"`
+	Pid     int       `json:"pid"`
+	Started time.Time `json:"started"`
+}
+
+// Lock creates the lock file, failing when another apply holds it. The returned function releases the lock.
+// The lock is only seen by applies using the same path, there is no lock on the server.
+func Lock(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		data, _ := os.ReadFile(path)
+		var info lockInfo
+		if json.Unmarshal(data, &info) == nil {
+			return nil, fmt.Errorf("fleet is locked by %s@%s (pid %d) since %s, remove %s if that apply is no longer running",
+				info.User, info.Host, info.Pid, info.Started.Format(time.RFC3339), path)
+		}
+		return nil, fmt.Errorf("fleet is locked, remove %s if no apply is running", path)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	host, _ := os.Hostname()
+	info := lockInfo{User: os.Getenv("USER"), Host: host, Pid: os.Getpid(), Started: time.Now()}
+	if err := json.NewEncoder(f).Encode(info); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	return func() { os.Remove(path) }, nil
+}
+
+// Apply executes the steps in order, reporting the progress of each one. It stops at the first failure.
+func Apply(ctx context.Context, steps []Step, catalog []drivers.Driver, otaTimeout time.Duration) error {
+	registry, err := boards.Default()
+	if err != nil {
+		return err
+	}
+
+	for i, s := range steps {
+		fmt.Printf("[%d/%d] %s %s ... ", i+1, len(steps), s.Action, s.Name)
+		start := time.Now()
+
+		err := execute(ctx, registry, s, catalog, otaTimeout)
+		if err != nil {
+			fmt.Println("failed")
+			return fmt.Errorf("%s %s: %v", s.Action, s.Name, err)
+		}
+
+		fmt.Printf("ok (%s)\n", time.Since(start).Round(100*time.Millisecond))
+	}
+
+	return nil
+}
+
+func execute(ctx context.Context, registry *boards.Registry, s Step, catalog []drivers.Driver, otaTimeout time.Duration) error {
+	switch s.Action {
+	case Create:
+		board, err := registry.Lookup(s.Board)
+		if err != nil {
+			return err
+		}
+		resp, err := nodes.CreateNode(ctx, s.Name, board)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("sn: %s key: %s ", resp.NodeSn, resp.NodeKey)
+	case Rename:
+		return nodes.RenameNode(ctx, s.Node.NodeSn, s.Name)
+	case Dataxserver:
+		return nodes.SetDataxserver(ctx, s.Node, s.Value)
+	case OTA:
+		if err := nodes.TriggerOTA(ctx, s.Node, *s.Layout, catalog); err != nil {
+			return err
+		}
+		return nodes.WaitOTA(ctx, s.Node, otaTimeout, nil)
+	case Delete:
+		return nodes.DeleteNode(ctx, s.Node.NodeSn)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package fleet
+
+import (
+	"context"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/drivers"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"strings"
+	"time"
+)
+
+const fleetHelp = `The fleet file describes the desired nodes of the account, eg.
+
+  version: 1
+  prune: false
+  nodes:
+    - name: gh1-soil
+      board: link
+      dataxserver: 192.168.1.10
+      layout:
+        connections:
+          - driver: GroveMoisture
+            port: A0
+
+Existing nodes are matched by node_sn when given, else by name. Nodes missing from the file are only
+deleted when prune is set.`
+
+func NewPlanCmd() *cobra.Command {
+	var file string
+	var prune bool
+	var planCmd = &cobra.Command{
+		Use:   "plan",
+		Short: "Show the changes needed to reach the fleet file",
+		Long:  "Compare the fleet file with your nodes and the layouts they run and print the changes 'wio apply' would make.\n\n" + fleetHelp,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("fleet")
+			steps, _, err := plan(cmd.Context(), logger, file, prune)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			printPlan(steps)
+		},
+	}
+
+	planCmd.Flags().StringVarP(&file, "file", "f", "fleet.yaml", "Fleet file, YAML or JSON")
+	planCmd.Flags().BoolVar(&prune, "prune", false, "Delete nodes which are not in the fleet file")
+
+	return planCmd
+}
+
+func NewApplyCmd() *cobra.Command {
+	var file, lockFile string
+	var yes, prune bool
+	var otaTimeout time.Duration
+	var applyCmd = &cobra.Command{
+		Use:   "apply",
+		Short: "Apply the fleet file",
+		Long: "Plan and, after confirmation, apply the changes needed to reach the fleet file. A lock file next to the\n" +
+			"fleet file prevents two applies from running at the same time. The lock is a local file, it only\n" +
+			"serializes applies sharing the fleet file, eg. on one machine or a shared directory, the server is\n" +
+			"not locked: teammates applying from their own checkout are not stopped.\n\n" + fleetHelp,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("fleet")
+			if lockFile == "" {
+				lockFile = file + ".lock"
+			}
+			unlock, err := Lock(lockFile)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			defer unlock()
+
+			steps, catalog, err := plan(cmd.Context(), logger, file, prune)
+			if err != nil {
+				unlock()
+				logger.Fatal(err)
+			}
+
+			printPlan(steps)
+			if len(steps) == 0 {
+				return
+			}
+
+			if !yes {
+				answer := internal.Prompt("\nApply these changes? (yes/no): ", "no")
+				if !strings.EqualFold(answer, "yes") && !strings.EqualFold(answer, "y") {
+					fmt.Println("Apply cancelled")
+					return
+				}
+			}
+
+			err = Apply(cmd.Context(), steps, catalog, otaTimeout)
+			if err != nil {
+				unlock()
+				logger.Fatal(err)
+			}
+			fmt.Println("Apply complete")
+		},
+	}
+
+	applyCmd.Flags().StringVarP(&file, "file", "f", "fleet.yaml", "Fleet file, YAML or JSON")
+	applyCmd.Flags().BoolVar(&prune, "prune", false, "Delete nodes which are not in the fleet file")
+	applyCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Apply without asking for confirmation")
+	applyCmd.Flags().StringVar(&lockFile, "lock-file", "", "Lock file (default is the fleet file with a .lock suffix)")
+	applyCmd.Flags().DurationVar(&otaTimeout, "ota-timeout", 5*time.Minute, "How long to wait for each OTA to finish")
+
+	return applyCmd
+}
+
+func plan(ctx context.Context, logger *log.Entry, file string, prune bool) ([]Step, []drivers.Driver, error) {
+	f, err := Load(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	catalog, err := drivers.Catalog(ctx, logger, 24*time.Hour, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	steps, err := Plan(ctx, logger, f, prune, catalog)
+	return steps, catalog, err
+}
+
+func printPlan(steps []Step) {
+	if len(steps) == 0 {
+		fmt.Println("No changes, the fleet matches the fleet file")
+		return
+	}
+
+	counts := map[Action]int{}
+	for _, s := range steps {
+		fmt.Println(s)
+		counts[s.Action]++
+	}
+	fmt.Printf("\nPlan: %d to create, %d to rename, %d dataxserver, %d to update over the air, %d to delete\n",
+		counts[Create], counts[Rename], counts[Dataxserver], counts[OTA], counts[Delete])
+}
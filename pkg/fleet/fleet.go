@@ -0,0 +1,202 @@
+package fleet
+
+import (
+	"context"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/pkg/boards"
+	"github.com/gabeduke/wio-cli-go/pkg/drivers"
+	"github.com/gabeduke/wio-cli-go/pkg/layout"
+	"github.com/gabeduke/wio-cli-go/pkg/nodes"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+)
+
+// Version is the fleet file format version understood by the CLI.
+const Version = 1
+
+// Fleet is the desired state of the nodes of an account.
+type Fleet struct {
+	Version int    `json:"version" yaml:"version"`
+	Prune   bool   `json:"prune" yaml:"prune"`
+	Nodes   []Node `json:"nodes" yaml:"nodes"`
+}
+
+// Node is the desired state of a node. Existing nodes are matched by serial number when one is given,
+// else by name.
+type Node struct {
+	Name        string         `json:"name" yaml:"name"`
+	NodeSn      string         `json:"node_sn,omitempty" yaml:"node_sn,omitempty"`
+	Board       string         `json:"board" yaml:"board"`
+	Dataxserver string         `json:"dataxserver,omitempty" yaml:"dataxserver,omitempty"`
+	Layout      *layout.Layout `json:"layout,omitempty" yaml:"layout,omitempty"`
+}
+
+// Load reads a fleet file, YAML or JSON.
+func Load(path string) (Fleet, error) {
+	var f Fleet
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+
+	// YAML is a superset of JSON
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return f, err
+	}
+
+	if f.Version > Version {
+		return f, fmt.Errorf("fleet file version %d is not supported, upgrade the CLI", f.Version)
+	}
+
+	seen := map[string]bool{}
+	for _, n := range f.Nodes {
+		if n.Name == "" {
+			return f, fmt.Errorf("fleet node without a name")
+		}
+		if seen[n.Name] {
+			return f, fmt.Errorf("duplicate fleet node: %s", n.Name)
+		}
+		seen[n.Name] = true
+	}
+
+	return f, nil
+}
+
+type Action string
+
+const (
+	Create      Action = "create"
+	Rename      Action = "rename"
+	Dataxserver Action = "dataxserver"
+	OTA         Action = "ota"
+	Delete      Action = "delete"
+)
+
+// Step is a single change of the plan.
+type Step struct {
+	Action  Action          `json:"action"`
+	Name    string          `json:"name"`
+	Node    nodes.Node      `json:"-"`
+	Board   string          `json:"board,omitempty"`
+	Value   string          `json:"value,omitempty"`
+	Layout  *layout.Layout  `json:"layout,omitempty"`
+	Changes []layout.Change `json:"changes,omitempty"`
+}
+
+func (s Step) String() string {
+	switch s.Action {
+	case Create:
+		return fmt.Sprintf("+ create %s (%s)", s.Name, s.Board)
+	case Rename:
+		return fmt.Sprintf("~ rename %s to %s", s.Node.Name, s.Name)
+	case Dataxserver:
+		return fmt.Sprintf("~ set dataxserver of %s to %s", s.Name, s.Value)
+	case OTA:
+		var changes []string
+		for _, c := range s.Changes {
+			changes = append(changes, "    "+c.String())
+		}
+		return fmt.Sprintf("~ ota %s\n%s", s.Name, strings.Join(changes, "\n"))
+	case Delete:
+		return fmt.Sprintf("- delete %s (%s)", s.Name, s.Node.NodeSn)
+	}
+	return string(s.Action) + " " + s.Name
+}
+
+// Plan compares the fleet with the nodes of the account and the layout each online node is running.
+// Layouts of offline nodes can not be read, they are reported as warnings and skipped.
+func Plan(ctx context.Context, logger *log.Entry, f Fleet, prune bool, catalog []drivers.Driver) ([]Step, error) {
+	list, err := nodes.ListNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []Step
+	matched := map[string]bool{}
+	for _, want := range f.Nodes {
+		current, ok := match(list.Nodes, want)
+		if !ok {
+			steps = append(steps, Step{Action: Create, Name: want.Name, Board: want.Board})
+			if want.Layout != nil {
+				logger.Warnf("%s: the layout can be applied once the new node is provisioned and online", want.Name)
+			}
+			continue
+		}
+		matched[current.NodeSn] = true
+
+		if current.Name != want.Name {
+			steps = append(steps, Step{Action: Rename, Name: want.Name, Node: current})
+		}
+
+		if want.Dataxserver != "" && fmt.Sprint(current.Dataxserver) != want.Dataxserver {
+			steps = append(steps, Step{Action: Dataxserver, Name: want.Name, Node: current, Value: want.Dataxserver})
+		}
+
+		if want.Layout == nil {
+			continue
+		}
+		if !current.Online {
+			logger.Warnf("%s is offline, its layout can not be compared", want.Name)
+			continue
+		}
+
+		running, err := nodes.GetLayout(ctx, current, catalog)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", want.Name, err)
+		}
+		desired := *want.Layout
+		if desired.Board == "" {
+			desired.Board = want.Board
+		}
+		if changes := layout.Diff(running, normalize(desired, running.Board)); len(changes) > 0 {
+			steps = append(steps, Step{Action: OTA, Name: want.Name, Node: current, Layout: &desired, Changes: changes})
+		}
+	}
+
+	if prune || f.Prune {
+		for _, n := range list.Nodes {
+			if !matched[n.NodeSn] {
+				steps = append(steps, Step{Action: Delete, Name: n.Name, Node: n})
+			}
+		}
+	}
+
+	return steps, nil
+}
+
+func match(list []nodes.Node, want Node) (nodes.Node, bool) {
+	for _, n := range list {
+		if want.NodeSn != "" && n.NodeSn == want.NodeSn {
+			return n, true
+		}
+	}
+	if want.NodeSn != "" {
+		return nodes.Node{}, false
+	}
+	for _, n := range list {
+		if n.Name == want.Name {
+			return n, true
+		}
+	}
+	return nodes.Node{}, false
+}
+
+// normalize replaces the board of the desired layout with the id used by the running layout when both
+// name the same board, so "link" and "Wio Link v1.0" are not reported as a change.
+func normalize(desired layout.Layout, running string) layout.Layout {
+	if strings.EqualFold(desired.Board, running) {
+		return desired
+	}
+	registry, err := boards.Default()
+	if err != nil {
+		return desired
+	}
+	if b, err := registry.Lookup(desired.Board); err == nil {
+		if r, err := registry.Lookup(running); err == nil && b.ID == r.ID {
+			desired.Board = running
+		}
+	}
+	return desired
+}
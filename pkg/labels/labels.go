@@ -0,0 +1,94 @@
+package labels
+
+import (
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/spf13/viper"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LABELS is the configuration key holding the labels of each node by serial number.
+const LABELS = "labels"
+
+// Set is the labels of a node.
+type Set map[string]string
+
+func (s Set) String() string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+s[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// keys are lower case since viper does not preserve the case of configuration keys
+var keyPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9._/-]*[a-z0-9])?$`)
+
+// ValidateKey checks a label key is lower case alphanumeric, '-', '_', '.' or '/'.
+func ValidateKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("invalid label key %q: must be lower case alphanumeric, '-', '_', '.' or '/'", key)
+	}
+	return nil
+}
+
+// All returns the labels of every node by serial number.
+func All() map[string]Set {
+	all := map[string]Set{}
+	for sn, labels := range viper.GetStringMap(LABELS) {
+		set := Set{}
+		if m, ok := labels.(map[string]interface{}); ok {
+			for k, v := range m {
+				set[k] = fmt.Sprint(v)
+			}
+		}
+		all[sn] = set
+	}
+	return all
+}
+
+// Get returns the labels of a node.
+func Get(sn string) Set {
+	if set, ok := All()[strings.ToLower(sn)]; ok {
+		return set
+	}
+	return Set{}
+}
+
+// Update applies label changes to a node and writes the configuration file. Changes are key=value pairs,
+// a key followed by '-' removes the label.
+func Update(sn string, changes []string) (Set, error) {
+	sn = strings.ToLower(sn)
+	set := Get(sn)
+
+	for _, c := range changes {
+		if strings.HasSuffix(c, "-") && !strings.Contains(c, "=") {
+			delete(set, strings.TrimSuffix(c, "-"))
+			continue
+		}
+
+		kv := strings.SplitN(c, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid label %q, use key=value or key- to remove", c)
+		}
+		if err := ValidateKey(kv[0]); err != nil {
+			return nil, err
+		}
+		set[kv[0]] = kv[1]
+	}
+
+	// only this node is written so concurrent label changes of other nodes are kept
+	var value interface{}
+	if len(set) > 0 {
+		value = set
+	}
+	return set, internal.UpdateConfig(LABELS+"."+sn, value)
+}
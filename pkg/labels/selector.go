@@ -0,0 +1,153 @@
+package labels
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type operator string
+
+const (
+	equals       operator = "="
+	notEquals    operator = "!="
+	in           operator = "in"
+	notIn        operator = "notin"
+	exists       operator = "exists"
+	doesNotExist operator = "!"
+)
+
+type requirement struct {
+	key    string
+	op     operator
+	values []string
+}
+
+func (r requirement) matches(set Set) bool {
+	value, ok := set[r.key]
+	switch r.op {
+	case equals:
+		return ok && value == r.values[0]
+	case notEquals:
+		return !ok || value != r.values[0]
+	case in:
+		return ok && contains(r.values, value)
+	case notIn:
+		return !ok || !contains(r.values, value)
+	case exists:
+		return ok
+	case doesNotExist:
+		return !ok
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Selector matches label sets. The syntax follows Kubernetes label selectors: comma separated
+// requirements which must all match, eg. "room=greenhouse,zone in (1,2),!disabled".
+type Selector struct {
+	requirements []requirement
+}
+
+// Matches reports whether every requirement of the selector matches the set.
+func (s Selector) Matches(set Set) bool {
+	for _, r := range s.requirements {
+		if !r.matches(set) {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty reports whether the selector has no requirements and so matches everything.
+func (s Selector) Empty() bool {
+	return len(s.requirements) == 0
+}
+
+// Parse parses a selector. Supported requirements are key=value, key==value, key!=value,
+// key in (v1,v2), key notin (v1,v2), key and !key.
+func Parse(selector string) (Selector, error) {
+	var s Selector
+	for _, part := range split(selector) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		r, err := parseRequirement(part)
+		if err != nil {
+			return s, err
+		}
+		s.requirements = append(s.requirements, r)
+	}
+	return s, nil
+}
+
+// split splits on commas outside of parentheses.
+func split(selector string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, selector[start:])
+}
+
+func parseRequirement(part string) (requirement, error) {
+	if strings.HasPrefix(part, "!") {
+		key := strings.TrimSpace(part[1:])
+		return requirement{key: key, op: doesNotExist}, ValidateKey(key)
+	}
+
+	for _, op := range []string{"!=", "==", "="} {
+		if i := strings.Index(part, op); i > 0 {
+			key := strings.TrimSpace(part[:i])
+			value := strings.TrimSpace(part[i+len(op):])
+			o := equals
+			if op == "!=" {
+				o = notEquals
+			}
+			return requirement{key: key, op: o, values: []string{value}}, ValidateKey(key)
+		}
+	}
+
+	fields := strings.Fields(part)
+	if len(fields) == 1 {
+		return requirement{key: fields[0], op: exists}, ValidateKey(fields[0])
+	}
+
+	if len(fields) >= 2 && (fields[1] == "in" || fields[1] == "notin") {
+		list := strings.TrimSpace(strings.TrimPrefix(part, fields[0]))
+		list = strings.TrimSpace(strings.TrimPrefix(list, fields[1]))
+		if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+			return requirement{}, fmt.Errorf("invalid selector %q: values must be in parentheses", part)
+		}
+
+		var values []string
+		for _, v := range strings.Split(list[1:len(list)-1], ",") {
+			values = append(values, strings.TrimSpace(v))
+		}
+		sort.Strings(values)
+		return requirement{key: fields[0], op: operator(fields[1]), values: values}, ValidateKey(fields[0])
+	}
+
+	return requirement{}, fmt.Errorf("invalid selector %q", part)
+}
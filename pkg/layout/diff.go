@@ -0,0 +1,107 @@
+package layout
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type ChangeKind string
+
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Moved   ChangeKind = "moved"
+	Board   ChangeKind = "board"
+)
+
+// Change is a difference between the current and the desired layout of a node.
+type Change struct {
+	Kind   ChangeKind `json:"kind" yaml:"kind"`
+	Driver string     `json:"driver,omitempty" yaml:"driver,omitempty"`
+	From   string     `json:"from,omitempty" yaml:"from,omitempty"`
+	To     string     `json:"to,omitempty" yaml:"to,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s on %s", c.Driver, c.To)
+	case Removed:
+		return fmt.Sprintf("- %s on %s", c.Driver, c.From)
+	case Moved:
+		return fmt.Sprintf("~ %s moved from %s to %s", c.Driver, c.From, c.To)
+	default:
+		return fmt.Sprintf("~ board %s -> %s", c.From, c.To)
+	}
+}
+
+// Diff returns the changes turning current into desired. A driver removed from one port and added to
+// another is reported as moved. Boards are only compared when both layouts name one.
+func Diff(current, desired Layout) []Change {
+	var changes []Change
+	if current.Board != "" && desired.Board != "" && !strings.EqualFold(current.Board, desired.Board) {
+		changes = append(changes, Change{Kind: Board, From: current.Board, To: desired.Board})
+	}
+
+	currentPorts := portsByDriver(current)
+	desiredPorts := portsByDriver(desired)
+
+	var names []string
+	for d := range currentPorts {
+		names = append(names, d)
+	}
+	for d := range desiredPorts {
+		if _, ok := currentPorts[d]; !ok {
+			names = append(names, d)
+		}
+	}
+	sort.Strings(names)
+
+	for _, d := range names {
+		removed := subtract(currentPorts[d], desiredPorts[d])
+		added := subtract(desiredPorts[d], currentPorts[d])
+
+		for len(removed) > 0 && len(added) > 0 {
+			changes = append(changes, Change{Kind: Moved, Driver: d, From: removed[0], To: added[0]})
+			removed, added = removed[1:], added[1:]
+		}
+		for _, p := range removed {
+			changes = append(changes, Change{Kind: Removed, Driver: d, From: p})
+		}
+		for _, p := range added {
+			changes = append(changes, Change{Kind: Added, Driver: d, To: p})
+		}
+	}
+
+	return changes
+}
+
+func portsByDriver(l Layout) map[string][]string {
+	ports := map[string][]string{}
+	for _, c := range l.Connections {
+		ports[c.Driver] = append(ports[c.Driver], strings.ToUpper(c.Port))
+	}
+	for _, p := range ports {
+		sort.Strings(p)
+	}
+	return ports
+}
+
+// subtract returns the ports of a which are not in b, counting duplicates.
+func subtract(a, b []string) []string {
+	remaining := map[string]int{}
+	for _, p := range b {
+		remaining[p]++
+	}
+
+	var out []string
+	for _, p := range a {
+		if remaining[p] > 0 {
+			remaining[p]--
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
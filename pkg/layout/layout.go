@@ -0,0 +1,118 @@
+package layout
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/pkg/boards"
+	"github.com/gabeduke/wio-cli-go/pkg/drivers"
+	"gopkg.in/yaml.v3"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Layout is the Grove configuration of a node, the firmware built by an OTA update includes one driver
+// instance per connection.
+type Layout struct {
+	Board       string       `json:"board" yaml:"board"`
+	Connections []Connection `json:"connections" yaml:"connections"`
+}
+
+// Connection is a Grove driver attached to a port of the board.
+type Connection struct {
+	Driver string `json:"driver" yaml:"driver"`
+	Port   string `json:"port" yaml:"port"`
+}
+
+var instancePattern = regexp.MustCompile(`^(.+?)((?:D|A|I2C|UART)\d+)$`)
+
+// ParseInstance splits a driver instance name into driver and port, eg. GroveTempHumI2C0 is the
+// GroveTempHum driver on port I2C0.
+func ParseInstance(instance string) (Connection, bool) {
+	m := instancePattern.FindStringSubmatch(instance)
+	if m == nil {
+		return Connection{}, false
+	}
+	return Connection{Driver: m[1], Port: m[2]}, true
+}
+
+// Load reads a layout file, JSON or YAML.
+func Load(path string) (Layout, error) {
+	var l Layout
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return l, err
+	}
+
+	// YAML is a superset of JSON
+	err = yaml.Unmarshal(data, &l)
+	return l, err
+}
+
+// YAML encodes the layout with the connections sorted by port.
+func (l Layout) YAML() ([]byte, error) {
+	l.Sort()
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err := enc.Encode(l)
+	return buf.Bytes(), err
+}
+
+// Sort orders the connections by port then driver.
+func (l *Layout) Sort() {
+	sort.Slice(l.Connections, func(i, j int) bool {
+		a, b := l.Connections[i], l.Connections[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		return a.Driver < b.Driver
+	})
+}
+
+// Validate checks the layout against the board definition: every port must exist, ports sharing a
+// connector can not be combined and, when a driver catalog is given, every driver must exist and its
+// interface must be supported by the port.
+func (l Layout) Validate(board boards.Board, catalog []drivers.Driver) error {
+	var problems []string
+	used := map[string]string{}
+	connectors := map[string]string{}
+
+	for _, c := range l.Connections {
+		port, ok := board.Port(c.Port)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: port %s does not exist on %s", c.Driver, c.Port, board.ServerID))
+			continue
+		}
+
+		if catalog != nil {
+			d, err := drivers.Find(catalog, c.Driver)
+			if err != nil {
+				problems = append(problems, err.Error())
+			} else if !port.Supports(d.InterfaceType) {
+				problems = append(problems, fmt.Sprintf("%s: %s driver can not be attached to port %s, use one of %s",
+					c.Driver, d.InterfaceType, port.Name, strings.Join(board.PortsFor(d.InterfaceType), ", ")))
+			}
+		}
+
+		// several drivers may share the I2C bus
+		if prev, ok := used[port.Name]; ok && !port.Supports("I2C") {
+			problems = append(problems, fmt.Sprintf("port %s is used by %s and %s", port.Name, prev, c.Driver))
+		}
+		used[port.Name] = c.Driver
+
+		if port.Connector != "" {
+			if prev, ok := connectors[port.Connector]; ok && prev != port.Name {
+				problems = append(problems, fmt.Sprintf("ports %s and %s share connector %s", prev, port.Name, port.Connector))
+			}
+			connectors[port.Connector] = port.Name
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid layout:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -1,45 +1,54 @@
 package nodes
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/drivers"
+	"github.com/gabeduke/wio-cli-go/pkg/fanout"
+	"github.com/gabeduke/wio-cli-go/pkg/labels"
+	"github.com/gabeduke/wio-cli-go/pkg/layout"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 )
 
-type boardEnum string
-
 var nodeName string
-var boardType boardEnum
+var boardType boardFlag
 
-const (
-	boardEnumNode boardEnum = "node"
-	boardEnumLink boardEnum = "link"
-)
+// boardFlag is a board id, display name or server identifier from the board registry
+type boardFlag string
 
 // String is used both by fmt.Print and by Cobra in help text
-func (e *boardEnum) String() string {
+func (e *boardFlag) String() string {
 	return string(*e)
 }
 
-// Set must have pointer receiver so it doesn't change the value of a copy
-func (e *boardEnum) Set(v string) error {
-	switch v {
-	case "node", "link":
-		*e = boardEnum(v)
-		return nil
-	default:
-		return errors.New(`must be one of "link", "node"`)
-	}
+// Set must have pointer receiver so it doesn't change the value of a copy. The value is checked against the
+// board registry when the command runs, flags are parsed before the configuration and its boards directory
+// are loaded.
+func (e *boardFlag) Set(v string) error {
+	*e = boardFlag(v)
+	return nil
 }
 
 // Type is only used in help text
-func (e *boardEnum) Type() string {
-	return "boardEnum"
+func (e *boardFlag) Type() string {
+	return "board"
 }
 
+// boardUsage is the help text of the --board flags, the registry is not loaded to build it.
+const boardUsage = "Wio Board type, an id, name or server id listed by 'wio boards'"
+
 func NewNodesCmd() *cobra.Command {
 	var nodesCmd = &cobra.Command{
 		Use:     "nodes",
@@ -50,6 +59,15 @@ func NewNodesCmd() *cobra.Command {
 	nodesCmd.AddCommand(newNodesRegisterCmd())
 	nodesCmd.AddCommand(newNodesCreateCmd())
 	nodesCmd.AddCommand(newNodesDeleteCmd())
+	nodesCmd.AddCommand(newNodesCallCmd())
+	nodesCmd.AddCommand(newNodesExportCmd())
+	nodesCmd.AddCommand(newNodesImportCmd())
+	nodesCmd.AddCommand(newNodesOtaCmd())
+	nodesCmd.AddCommand(newNodesConfigCmd())
+	nodesCmd.AddCommand(newNodesSleepCmd())
+	nodesCmd.AddCommand(newNodesPowerCmd())
+	nodesCmd.AddCommand(newNodesLabelCmd())
+	nodesCmd.AddCommand(NewNodesListCmd())
 
 	return nodesCmd
 }
@@ -61,7 +79,7 @@ func newNodesRegisterCmd() *cobra.Command {
 		Short: "Register a node",
 		Run: func(cmd *cobra.Command, args []string) {
 			logger := internal.CreateNamedLogger("nodes")
-			err := RegisterNode()
+			err := RegisterNode(cmd.Context())
 			if err != nil {
 				logger.Fatal(err)
 			}
@@ -72,7 +90,7 @@ func newNodesRegisterCmd() *cobra.Command {
 	nodesRegisterCmd.Flags().StringVarP(&sn, "sn", "s", "", "Serial number of the node")
 	nodesRegisterCmd.Flags().StringVarP(&key, "key", "k", "", "Key of the node")
 	nodesRegisterCmd.Flags().StringVarP(&nodeName, "name", "n", "", "Name of the node")
-	nodesRegisterCmd.Flags().Var(&boardType, "board", `Wio Board type. allowed: "node", "link""`)
+	nodesRegisterCmd.Flags().Var(&boardType, "board", boardUsage)
 	viper.BindPFlag("create", nodesRegisterCmd.Flags().Lookup("create"))
 	viper.BindPFlag("name", nodesRegisterCmd.Flags().Lookup("name"))
 	viper.BindPFlag("board", nodesRegisterCmd.Flags().Lookup("board"))
@@ -88,7 +106,12 @@ func newNodesCreateCmd() *cobra.Command {
 		Short: "Create a new node",
 		Run: func(cmd *cobra.Command, args []string) {
 			logger := internal.CreateNamedLogger("nodes")
-			resp, err := CreateNode(nodeName, boardType)
+			board, err := lookupBoard(string(boardType))
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			resp, err := CreateNode(cmd.Context(), nodeName, board)
 			if err != nil {
 				logger.Fatal(err)
 			}
@@ -104,7 +127,7 @@ func newNodesCreateCmd() *cobra.Command {
 	}
 
 	nodesCreateCmd.Flags().StringVarP(&nodeName, "name", "n", "", "Name of the node")
-	nodesCreateCmd.Flags().Var(&boardType, "board", `Wio Board type. allowed: "node", "link""`)
+	nodesCreateCmd.Flags().Var(&boardType, "board", boardUsage)
 	viper.BindPFlag("name", nodesCreateCmd.Flags().Lookup("name"))
 	viper.BindPFlag("board", nodesCreateCmd.Flags().Lookup("board"))
 
@@ -115,13 +138,38 @@ func newNodesCreateCmd() *cobra.Command {
 }
 
 func newNodesDeleteCmd() *cobra.Command {
-	var sn string
+	var sn, selector string
+	var yes bool
+	var opts fanout.Options
 	var nodesDeleteCmd = &cobra.Command{
 		Use:   "delete",
 		Short: "Delete a node",
+		Long: `Delete a node by serial number, or every node matching a label selector. The nodes matching a selector
+are listed and must be confirmed, or --yes given when not running in a terminal. The shorthand of --selector
+is -L, -l being --log-level.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			logger := internal.CreateNamedLogger("nodes")
-			err := DeleteNode(sn)
+			if (sn == "") == (selector == "") {
+				logger.Fatal("either --sn or --selector is required")
+			}
+
+			if selector != "" {
+				nodes, err := targetNodes(cmd.Context(), nil, selector)
+				if err != nil {
+					logger.Fatal(err)
+				}
+
+				if err := confirmDelete(os.Stdout, nodes, yes); err != nil {
+					logger.Fatal(err)
+				}
+
+				fanOut(cmd.Context(), nodes, opts, func(ctx context.Context, node Node) (interface{}, error) {
+					return nil, DeleteNode(ctx, node.NodeSn)
+				})
+				return
+			}
+
+			err := DeleteNode(cmd.Context(), sn)
 			if err != nil {
 				logger.Fatal(err)
 			}
@@ -132,20 +180,28 @@ func newNodesDeleteCmd() *cobra.Command {
 	}
 
 	nodesDeleteCmd.Flags().StringVarP(&sn, "sn", "s", "", "Serial number of the node")
+	nodesDeleteCmd.Flags().StringVarP(&selector, "selector", "L", "", "Delete the nodes matching a label selector")
+	nodesDeleteCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Delete the nodes matching --selector without confirmation")
+	fanout.AddFlags(nodesDeleteCmd.Flags(), &opts)
 	viper.BindPFlag("sn", nodesDeleteCmd.Flags().Lookup("sn"))
 
-	cobra.MarkFlagRequired(nodesDeleteCmd.Flags(), "sn")
-
 	return nodesDeleteCmd
 }
 
 func NewNodesListCmd() *cobra.Command {
+	var selector string
 	var nodesListCmd = &cobra.Command{
 		Use:   "list",
 		Short: "List all of your nodes",
 		Run: func(cmd *cobra.Command, args []string) {
 			logger := internal.CreateNamedLogger("nodes")
-			nodes, err := ListNodes()
+			var nodes ListResp
+			var err error
+			if selector != "" {
+				nodes.Nodes, err = SelectNodes(cmd.Context(), selector)
+			} else {
+				nodes, err = ListNodes(cmd.Context())
+			}
 			if err != nil {
 				logger.Fatal(err)
 			}
@@ -154,5 +210,596 @@ func NewNodesListCmd() *cobra.Command {
 		},
 	}
 
+	nodesListCmd.Flags().StringVarP(&selector, "selector", "L", "", selectorUsage)
+
 	return nodesListCmd
 }
+
+// The shorthand of --selector is -L, as -l is the --log-level flag of the root command.
+const selectorUsage = `Only the nodes matching a label selector, eg. "room=greenhouse,zone in (1,2),!disabled"`
+
+// confirmDelete lists the nodes about to be deleted and asks for a confirmation, unless yes is set. Without a
+// terminal to ask on, yes is required.
+func confirmDelete(out io.Writer, nodes []Node, yes bool) error {
+	fmt.Fprintln(out, "Nodes to delete:")
+	for _, n := range nodes {
+		fmt.Fprintf(out, "  %s (%s)\n", n.Name, n.NodeSn)
+	}
+	if yes {
+		return nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("refusing to delete %d nodes without --yes", len(nodes))
+	}
+
+	answer := internal.Prompt(fmt.Sprintf("Delete these %d nodes? [y/N] ", len(nodes)), "n")
+	if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+		return fmt.Errorf("aborted, no node was deleted")
+	}
+	return nil
+}
+
+// targetNodes resolves the node named in args, or the nodes matching the selector when one is given.
+func targetNodes(ctx context.Context, args []string, selector string) ([]Node, error) {
+	if selector != "" {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("a node can not be combined with --selector")
+		}
+		nodes, err := SelectNodes(ctx, selector)
+		if err == nil && len(nodes) == 0 {
+			err = fmt.Errorf("no nodes match the selector %q", selector)
+		}
+		return nodes, err
+	}
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("a node or --selector is required")
+	}
+
+	node, err := FindNode(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return []Node{node}, nil
+}
+
+// fanOut runs an operation on several nodes, prints the summary and exits non-zero if any node failed.
+func fanOut(ctx context.Context, nodes []Node, opts fanout.Options, fn func(context.Context, Node) (interface{}, error)) {
+	summary := fanout.Run(ctx, nodes, func(n Node) string { return n.Name }, opts, fn)
+	if err := summary.Print(os.Stdout, opts.Output); err != nil {
+		internal.CreateNamedLogger("nodes").Fatal(err)
+	}
+	if summary.Failed() {
+		os.Exit(1)
+	}
+}
+
+func newNodesCallCmd() *cobra.Command {
+	var selector string
+	var opts fanout.Options
+	var nodesCallCmd = &cobra.Command{
+		Use:   "call [node] <method> <path>",
+		Short: "Call a Grove resource on a node",
+		Long: `Call the REST API exposed by the Grove drivers of a node. The node may be given by name or serial number,
+or the call is made on every node matching --selector. Use GET to read a property and POST to write one, eg.
+
+  wio nodes call greenhouse GET GroveTempHumD0/temperature
+  wio nodes call greenhouse POST GroveRelayD0/onoff/1
+  wio nodes call --selector room=greenhouse POST GroveRelayD0/onoff/0`,
+		Args: cobra.RangeArgs(2, 3),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("nodes")
+			nodes, err := targetNodes(cmd.Context(), args[:len(args)-2], selector)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			method, path := args[len(args)-2], args[len(args)-1]
+
+			if len(nodes) > 1 {
+				fanOut(cmd.Context(), nodes, opts, func(ctx context.Context, node Node) (interface{}, error) {
+					result, err := CallNode(ctx, node, method, path)
+					var asleep *AsleepError
+					if errors.As(err, &asleep) {
+						return asleep.Error(), nil
+					}
+					return result, err
+				})
+				return
+			}
+
+			result, err := CallNode(cmd.Context(), nodes[0], method, path)
+			var asleep *AsleepError
+			if errors.As(err, &asleep) {
+				fmt.Println(asleep)
+				return
+			} else if err != nil {
+				logger.Fatal(err)
+			}
+
+			data, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				logger.Fatal(err)
+			}
+			fmt.Printf("%s\n", data)
+		},
+	}
+
+	nodesCallCmd.Flags().StringVarP(&selector, "selector", "L", "", "Call every node matching a label selector")
+	fanout.AddFlags(nodesCallCmd.Flags(), &opts)
+
+	return nodesCallCmd
+}
+
+func newNodesExportCmd() *cobra.Command {
+	var output, format string
+	var nodesExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export the node inventory",
+		Long: `Export every node (name, board, serial number, key, dataxserver and the attached Grove drivers of online
+nodes) to a versioned YAML or JSON file which can be imported on another server with 'nodes import'.
+The file contains the node keys, keep it safe.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("nodes")
+			inv, err := ExportInventory(cmd.Context())
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			data, err := Marshal(inv, isJSON(output, format))
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			if output == "" {
+				fmt.Print(string(data))
+				return
+			}
+
+			err = os.WriteFile(output, data, 0600)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			fmt.Printf("Exported %d nodes to %s\n", len(inv.Nodes), output)
+		},
+	}
+
+	nodesExportCmd.Flags().StringVarP(&output, "output", "o", "", "Output file (default stdout)")
+	nodesExportCmd.Flags().StringVar(&format, "format", "", `Output format: "yaml" or "json" (default from the file extension, else yaml)`)
+
+	return nodesExportCmd
+}
+
+func newNodesImportCmd() *cobra.Command {
+	var file, mappingFile string
+	var dryRun, provision bool
+	var nodesImportCmd = &cobra.Command{
+		Use:   "import",
+		Short: "Recreate nodes from an exported inventory",
+		Long: `Create every node of an inventory file on the configured server and print the mapping of the old
+serial numbers and keys to the new ones. With --provision each device is re-provisioned with its new
+credentials through AP mode, one after the other.
+
+Nodes whose name and board already exist on the server are skipped and mapped to the existing node, so an
+import which failed half way can be run again. The import stops when a node could match several others, eg.
+two nodes of the same name and board on the server. When a node can not be created, the mapping of the
+nodes handled so far is still printed and written to --mapping before the command fails.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("nodes")
+			inv, err := LoadInventory(file)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			mapping, importErr := ImportInventory(cmd.Context(), inv, dryRun)
+
+			data, err := Marshal(mapping, mappingFile == "" || isJSON(mappingFile, ""))
+			if err != nil {
+				logger.Fatal(err)
+			}
+			if mappingFile != "" {
+				err = os.WriteFile(mappingFile, data, 0600)
+				if err != nil {
+					logger.Fatal(err)
+				}
+			}
+			fmt.Print(string(data))
+
+			if importErr != nil {
+				logger.Fatalf("Import stopped after %d of %d nodes: %v", len(mapping), len(inv.Nodes), importErr)
+			}
+
+			if provision && !dryRun {
+				err = provisionNodes(cmd.Context(), mapping)
+				if err != nil {
+					logger.Fatal(err)
+				}
+			}
+		},
+	}
+
+	nodesImportCmd.Flags().StringVarP(&file, "file", "f", "", "Inventory file written by 'nodes export'")
+	nodesImportCmd.Flags().StringVar(&mappingFile, "mapping", "", "Write the old to new serial number and key mapping to this file")
+	nodesImportCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Validate the inventory without creating nodes")
+	nodesImportCmd.Flags().BoolVar(&provision, "provision", false, "Re-provision each device with its new credentials through AP mode")
+
+	cobra.MarkFlagRequired(nodesImportCmd.Flags(), "file")
+
+	return nodesImportCmd
+}
+
+func provisionNodes(ctx context.Context, mapping []ImportMapping) error {
+	ssid := internal.Prompt("Enter the name of the SSID the nodes connect to: ", "")
+	pass := internal.Prompt("Enter the password for the SSID: ", "")
+
+	for _, m := range mapping {
+		answer := internal.Prompt(fmt.Sprintf("Put %s in AP mode and connect to it, then hit RETURN (s to skip): ", m.Name), "")
+		if answer == "s" {
+			continue
+		}
+
+		reply, err := ConfigureAP(ctx, ssid, pass, m.NewKey, m.NewSn)
+		if err != nil {
+			return fmt.Errorf("provisioning %s: %v", m.Name, err)
+		}
+		fmt.Println(reply)
+	}
+
+	return nil
+}
+
+func newNodesOtaCmd() *cobra.Command {
+	var file, selector string
+	var opts fanout.Options
+	var wait bool
+	var timeout time.Duration
+	var nodesOtaCmd = &cobra.Command{
+		Use:   "ota [node]",
+		Short: "Update the Grove drivers of a node over the air",
+		Long: `Build a firmware with the Grove drivers of a layout file and flash it to the node over the air.
+The layout is validated against the board definition and the driver catalog before the update starts, eg.
+
+  board: link
+  connections:
+    - driver: GroveTempHum
+      port: I2C0
+    - driver: GroveRelay
+      port: D0
+
+The update is applied to a single node or to every node matching --selector. With --wait the time allowed
+for each node defaults to --ota-timeout plus a minute for starting the update, --node-timeout overrides it.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("nodes")
+			l, err := layout.Load(file)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			nodes, err := targetNodes(cmd.Context(), args, selector)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			catalog, err := drivers.Catalog(cmd.Context(), logger, 24*time.Hour, false)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			if len(nodes) > 1 {
+				if wait && !cmd.Flags().Changed("node-timeout") {
+					opts.Timeout = timeout + otaTriggerMargin
+				}
+				fanOut(cmd.Context(), nodes, opts, func(ctx context.Context, node Node) (interface{}, error) {
+					if err := TriggerOTA(ctx, node, l, catalog); err != nil {
+						return nil, err
+					}
+					if !wait {
+						return "started", nil
+					}
+					return "done", WaitOTA(ctx, node, timeout, nil)
+				})
+				return
+			}
+
+			node := nodes[0]
+			err = TriggerOTA(cmd.Context(), node, l, catalog)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			fmt.Printf("OTA started on %s\n", node.Name)
+
+			if !wait {
+				return
+			}
+
+			err = WaitOTA(cmd.Context(), node, timeout, func(status OTAStatus) {
+				fmt.Printf("%s: %s\n", status.Status, status.Message)
+			})
+			if err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	nodesOtaCmd.Flags().StringVarP(&file, "file", "f", "", "Layout file, YAML or JSON")
+	nodesOtaCmd.Flags().BoolVar(&wait, "wait", true, "Wait for the update to finish")
+	nodesOtaCmd.Flags().DurationVar(&timeout, "ota-timeout", 5*time.Minute, "How long to wait for the update to finish")
+	nodesOtaCmd.Flags().StringVarP(&selector, "selector", "L", "", "Update every node matching a label selector")
+	fanout.AddFlags(nodesOtaCmd.Flags(), &opts)
+
+	cobra.MarkFlagRequired(nodesOtaCmd.Flags(), "file")
+
+	nodesOtaCmd.AddCommand(newNodesOtaRolloutCmd())
+
+	return nodesOtaCmd
+}
+
+func newNodesOtaRolloutCmd() *cobra.Command {
+	var file, selector string
+	var opts RolloutOptions
+	var rolloutCmd = &cobra.Command{
+		Use:   "rollout",
+		Short: "Update the nodes matching a selector in stages",
+		Long: `Update the nodes matching --selector in stages: the canary nodes first, then batches of --batch nodes.
+Every updated node must come back online and advertise the drivers of the layout on .well-known.
+
+The rollout halts when a canary fails or when the failure rate exceeds --max-failure-rate. Its state is
+saved in ~/.wio/rollouts/<name>.json after every batch; running the same command again resumes with the
+pending and failed nodes, then the nodes which matched --selector since the rollout started, eg.
+
+  wio nodes ota rollout -f layout.yaml --selector env=prod --canary 2 --batch 5`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("nodes")
+			l, err := layout.Load(file)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			nodes, err := targetNodes(cmd.Context(), nil, selector)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			catalog, err := drivers.Catalog(cmd.Context(), logger, 24*time.Hour, false)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			if opts.Name == "" {
+				opts.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+			}
+
+			r, err := StartRollout(cmd.Context(), nodes, l, catalog, opts, func(msg string) {
+				fmt.Println(msg)
+			})
+			if r != nil {
+				fmt.Printf("Rollout %s: %d done, %d failed, %d pending\n", r.Name, r.count(rolloutDone), r.count(rolloutFailed), r.count(rolloutPending))
+			}
+			if err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	rolloutCmd.Flags().StringVarP(&file, "file", "f", "", "Layout file, YAML or JSON")
+	rolloutCmd.Flags().StringVarP(&selector, "selector", "L", "", "Update every node matching a label selector")
+	rolloutCmd.Flags().StringVar(&opts.Name, "name", "", "Name of the rollout state (default the layout file name)")
+	rolloutCmd.Flags().IntVar(&opts.Canary, "canary", 1, "Number of nodes to update before the first batch")
+	rolloutCmd.Flags().IntVar(&opts.Batch, "batch", 5, "Number of nodes to update at once after the canaries")
+	rolloutCmd.Flags().Float64Var(&opts.MaxFailureRate, "max-failure-rate", 0.2, "Halt when this fraction of the updated nodes failed")
+	rolloutCmd.Flags().DurationVar(&opts.OTATimeout, "ota-timeout", 5*time.Minute, "How long to wait for each update to finish")
+	rolloutCmd.Flags().DurationVar(&opts.OnlineTimeout, "online-timeout", 2*time.Minute, "How long to wait for each node to come back online")
+	rolloutCmd.Flags().BoolVar(&opts.Restart, "restart", false, "Discard the saved state and start over")
+
+	cobra.MarkFlagRequired(rolloutCmd.Flags(), "file")
+	cobra.MarkFlagRequired(rolloutCmd.Flags(), "selector")
+
+	return rolloutCmd
+}
+
+func newNodesConfigCmd() *cobra.Command {
+	var nodesConfigCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Read the Grove configuration of a node",
+	}
+
+	nodesConfigCmd.AddCommand(newNodesConfigGetCmd())
+	nodesConfigCmd.AddCommand(newNodesConfigDiffCmd())
+
+	return nodesConfigCmd
+}
+
+func newNodesConfigGetCmd() *cobra.Command {
+	var format string
+	var nodesConfigGetCmd = &cobra.Command{
+		Use:   "get <node>",
+		Short: "Print the Grove layout a node is running",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("nodes")
+			l, err := getLayout(cmd.Context(), logger, args[0])
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			data, err := l.YAML()
+			if format == "json" {
+				data, err = Marshal(l, true)
+			}
+			if err != nil {
+				logger.Fatal(err)
+			}
+			fmt.Print(string(data))
+		},
+	}
+
+	nodesConfigGetCmd.Flags().StringVarP(&format, "output", "o", "yaml", `Output format: "yaml" or "json"`)
+
+	return nodesConfigGetCmd
+}
+
+func newNodesConfigDiffCmd() *cobra.Command {
+	var file string
+	var nodesConfigDiffCmd = &cobra.Command{
+		Use:   "diff <node>",
+		Short: "Compare the Grove layout of a node with a layout file",
+		Long: `Compare the Grove layout a node is running with the desired layout file and print the drivers to add,
+remove or move. The command exits with status 1 when the node drifted from the desired layout.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("nodes")
+			desired, err := layout.Load(file)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			if board, err := lookupBoard(desired.Board); err == nil {
+				desired.Board = board.ID
+			}
+
+			current, err := getLayout(cmd.Context(), logger, args[0])
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			changes := layout.Diff(current, desired)
+			if len(changes) == 0 {
+				fmt.Printf("%s matches %s\n", args[0], file)
+				return
+			}
+
+			for _, c := range changes {
+				fmt.Println(c)
+			}
+			os.Exit(1)
+		},
+	}
+
+	nodesConfigDiffCmd.Flags().StringVarP(&file, "file", "f", "", "Desired layout file, YAML or JSON")
+
+	cobra.MarkFlagRequired(nodesConfigDiffCmd.Flags(), "file")
+
+	return nodesConfigDiffCmd
+}
+
+func getLayout(ctx context.Context, logger *log.Entry, nameOrSn string) (layout.Layout, error) {
+	node, err := FindNode(ctx, nameOrSn)
+	if err != nil {
+		return layout.Layout{}, err
+	}
+
+	catalog, err := drivers.Catalog(ctx, logger, 24*time.Hour, false)
+	if err != nil {
+		logger.Warnf("Unable to load the driver catalog: %v", err)
+	}
+
+	return GetLayout(ctx, node, catalog)
+}
+
+func newNodesSleepCmd() *cobra.Command {
+	var duration time.Duration
+	var nodesSleepCmd = &cobra.Command{
+		Use:   "sleep <node>",
+		Short: "Put a node into deep sleep",
+		Long: `Put a battery powered node into deep sleep, it wakes up and reconnects once the duration elapsed.
+Until then the node is expected to be offline: 'nodes call' and the watchers report it as asleep instead of failing.
+To run sleep cycles, schedule the sleep call, eg.
+
+  wio schedule add --cron "*/15 * * * *" --node outdoor --method POST --path pm/sleep/600`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("nodes")
+			node, err := FindNode(cmd.Context(), args[0])
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			err = Sleep(cmd.Context(), node, duration)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			fmt.Printf("%s is asleep until %s\n", node.Name, time.Now().Add(duration).Format(time.RFC3339))
+		},
+	}
+
+	nodesSleepCmd.Flags().DurationVar(&duration, "for", 0, "How long the node sleeps, eg. 10m")
+
+	cobra.MarkFlagRequired(nodesSleepCmd.Flags(), "for")
+
+	return nodesSleepCmd
+}
+
+func newNodesPowerCmd() *cobra.Command {
+	var nodesPowerCmd = &cobra.Command{
+		Use:   "power [node]",
+		Short: "Show whether nodes are expected to be asleep",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("nodes")
+			list, err := ListNodes(cmd.Context())
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			states, err := LoadSleepStates()
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSN\tONLINE\tPOWER")
+			for _, n := range list.Nodes {
+				if len(args) > 0 && n.Name != args[0] && n.NodeSn != args[0] {
+					continue
+				}
+
+				power := "awake"
+				if s, ok := states[n.NodeSn]; ok && time.Now().Before(s.Until) {
+					power = "asleep until " + s.Until.Format(time.RFC3339)
+				} else if !n.Online {
+					power = "offline"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", n.Name, n.NodeSn, n.Online, power)
+			}
+			w.Flush()
+		},
+	}
+
+	return nodesPowerCmd
+}
+
+func newNodesLabelCmd() *cobra.Command {
+	var nodesLabelCmd = &cobra.Command{
+		Use:   "label <node> [key=value...] [key-...]",
+		Short: "Set or remove local labels of a node",
+		Long: `Labels are stored in the configuration file and group nodes for the --selector flag of list, call,
+delete and ota, eg.
+
+  wio nodes label gh1-soil-3 room=greenhouse zone=1
+  wio nodes label gh1-soil-3 zone-
+  wio nodes list --selector "room=greenhouse,zone in (1,2)"
+
+Without changes the labels of the node are printed.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("nodes")
+			node, err := FindNode(cmd.Context(), args[0])
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			set := node.Labels
+			if len(args) > 1 {
+				set, err = labels.Update(node.NodeSn, args[1:])
+				if err != nil {
+					logger.Fatal(err)
+				}
+			}
+
+			fmt.Printf("%s: %s\n", node.Name, set)
+		},
+	}
+
+	return nodesLabelCmd
+}
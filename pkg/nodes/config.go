@@ -0,0 +1,65 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/pkg/drivers"
+	"github.com/gabeduke/wio-cli-go/pkg/layout"
+	"gopkg.in/yaml.v3"
+	"strings"
+)
+
+// GetLayout reads the Grove configuration the node firmware was built with and returns it as a layout.
+// The server answers either with the YAML connection config keyed by driver instance, eg. GroveTempHumI2C0,
+// or with the board name and connections of the last OTA; SKUs are resolved to drivers with the catalog.
+func GetLayout(ctx context.Context, node Node, catalog []drivers.Driver) (layout.Layout, error) {
+	l := layout.Layout{Board: node.Board}
+
+	result, err := CallNode(ctx, node, "GET", "config")
+	if err != nil {
+		return l, err
+	}
+
+	switch config := result["config"].(type) {
+	case string:
+		instances := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(config), &instances); err != nil {
+			return l, fmt.Errorf("unable to parse the configuration of %s: %v", node.Name, err)
+		}
+		for instance := range instances {
+			c, ok := layout.ParseInstance(instance)
+			if !ok {
+				return l, fmt.Errorf("unable to parse driver instance %s of %s", instance, node.Name)
+			}
+			l.Connections = append(l.Connections, c)
+		}
+	case map[string]interface{}:
+		if board, ok := config["board_name"].(string); ok && board != "" {
+			l.Board = board
+		}
+		connections, _ := config["connections"].([]interface{})
+		for _, c := range connections {
+			conn, _ := c.(map[string]interface{})
+			sku := fmt.Sprint(conn["sku"])
+			port := fmt.Sprint(conn["port"])
+
+			driver := sku
+			for _, d := range catalog {
+				if d.SKU == sku {
+					driver = d.ClassName
+					break
+				}
+			}
+			l.Connections = append(l.Connections, layout.Connection{Driver: driver, Port: strings.ToUpper(port)})
+		}
+	default:
+		return l, fmt.Errorf("unexpected configuration response of %s: %v", node.Name, result)
+	}
+
+	if board, err := lookupBoard(l.Board); err == nil {
+		l.Board = board.ID
+	}
+	l.Sort()
+
+	return l, nil
+}
@@ -0,0 +1,70 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gorilla/websocket"
+	"strings"
+)
+
+// NodeEvent is an event reported by a Grove driver, eg. {"button_pressed": "1"}.
+type NodeEvent map[string]interface{}
+
+type eventMessage struct {
+	Msg   NodeEvent `json:"msg"`
+	Error string    `json:"error"`
+}
+
+// SubscribeEvents streams the events of a node over the server websocket until ctx is cancelled
+// or the connection fails.
+func SubscribeEvents(ctx context.Context, node Node, events chan<- NodeEvent) error {
+	ep, err := getURIFromConfig()
+	if err != nil {
+		return err
+	}
+	ep.Scheme = strings.Replace(ep.Scheme, "http", "ws", 1)
+	ep.Path = "/v1/node/event"
+
+	dialer, err := internal.WebsocketDialer()
+	if err != nil {
+		return err
+	}
+
+	conn, _, err := dialer.DialContext(ctx, ep.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	// the server expects the node key as the first message
+	err = conn.WriteMessage(websocket.TextMessage, []byte(node.NodeKey))
+	if err != nil {
+		return err
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		var msg eventMessage
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Msg == nil {
+			continue
+		}
+
+		select {
+		case events <- msg.Msg:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
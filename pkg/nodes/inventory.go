@@ -0,0 +1,221 @@
+package nodes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/layout"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// InventoryVersion is the version of the inventory file format written by ExportInventory.
+const InventoryVersion = 1
+
+// Inventory is a backup of the nodes of an account which can be imported on another server.
+type Inventory struct {
+	Version  int             `json:"version" yaml:"version"`
+	Server   string          `json:"server" yaml:"server"`
+	Exported time.Time       `json:"exported" yaml:"exported"`
+	Nodes    []InventoryNode `json:"nodes" yaml:"nodes"`
+}
+
+type InventoryNode struct {
+	Name        string              `json:"name" yaml:"name"`
+	Board       string              `json:"board" yaml:"board"`
+	NodeSn      string              `json:"node_sn" yaml:"node_sn"`
+	NodeKey     string              `json:"node_key" yaml:"node_key"`
+	Dataxserver interface{}         `json:"dataxserver,omitempty" yaml:"dataxserver,omitempty"`
+	Grove       []layout.Connection `json:"grove,omitempty" yaml:"grove,omitempty"`
+}
+
+// ImportMapping records the credentials of a node before and after an import. Existing is set when a node of
+// the same name and board was already on the server, eg. created by an interrupted import, and was not
+// created again.
+type ImportMapping struct {
+	Name     string `json:"name" yaml:"name"`
+	OldSn    string `json:"old_sn" yaml:"old_sn"`
+	OldKey   string `json:"old_key" yaml:"old_key"`
+	NewSn    string `json:"new_sn" yaml:"new_sn"`
+	NewKey   string `json:"new_key" yaml:"new_key"`
+	Existing bool   `json:"existing,omitempty" yaml:"existing,omitempty"`
+}
+
+// groveLayout derives the attached Grove drivers from the resources a node advertises,
+// eg. GroveTempHumD0 is the GroveTempHum driver on port D0.
+func groveLayout(resources []Resource) []layout.Connection {
+	var connections []layout.Connection
+	seen := map[string]bool{}
+	for _, r := range resources {
+		instance := r.Instance()
+		if seen[instance] {
+			continue
+		}
+		seen[instance] = true
+
+		if c, ok := layout.ParseInstance(instance); ok {
+			connections = append(connections, c)
+		}
+	}
+	return connections
+}
+
+// ExportInventory collects every node of the account. The Grove layout is included for nodes which are online.
+func ExportInventory(ctx context.Context) (Inventory, error) {
+	inv := Inventory{
+		Version:  InventoryVersion,
+		Server:   viper.GetString(internal.HOST),
+		Exported: time.Now().UTC(),
+	}
+
+	list, err := ListNodes(ctx)
+	if err != nil {
+		return inv, err
+	}
+
+	logger := internal.CreateNamedLogger("nodes")
+	for _, n := range list.Nodes {
+		node := InventoryNode{
+			Name:        n.Name,
+			Board:       n.Board,
+			NodeSn:      n.NodeSn,
+			NodeKey:     n.NodeKey,
+			Dataxserver: n.Dataxserver,
+		}
+
+		if n.Online {
+			resources, err := WellKnown(ctx, n)
+			if err != nil {
+				logger.WithField("sn", n.NodeSn).Warnf("Unable to read Grove layout of %s: %v", n.Name, err)
+			} else {
+				node.Grove = groveLayout(resources)
+			}
+		}
+
+		inv.Nodes = append(inv.Nodes, node)
+	}
+
+	return inv, nil
+}
+
+// isJSON reports whether a file should be encoded as JSON rather than YAML.
+func isJSON(path, format string) bool {
+	if format != "" {
+		return format == "json"
+	}
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// Marshal encodes v as JSON or YAML.
+func Marshal(v interface{}, asJSON bool) ([]byte, error) {
+	if asJSON {
+		data, err := json.MarshalIndent(v, "", "  ")
+		return append(data, '\n'), err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	err := enc.Encode(v)
+	return buf.Bytes(), err
+}
+
+// LoadInventory reads an inventory file, JSON or YAML.
+func LoadInventory(path string) (Inventory, error) {
+	var inv Inventory
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return inv, err
+	}
+
+	// YAML is a superset of JSON
+	err = yaml.Unmarshal(data, &inv)
+	if err != nil {
+		return inv, err
+	}
+
+	if inv.Version > InventoryVersion {
+		return inv, fmt.Errorf("inventory version %d is not supported, upgrade the CLI", inv.Version)
+	}
+
+	return inv, nil
+}
+
+// ImportInventory creates every node of the inventory on the configured server. A node already on the server
+// with the same name and board is not created again, its current credentials are mapped instead, so that a
+// failed import can be run again. The import stops when several nodes could match, eg. two nodes of the same
+// name and board on the server. On error the mapping of the nodes handled so far is returned.
+func ImportInventory(ctx context.Context, inv Inventory, dryRun bool) ([]ImportMapping, error) {
+	var mapping []ImportMapping
+	list, err := ListNodes(ctx)
+	if err != nil {
+		return mapping, err
+	}
+
+	// the nodes of the server and of the inventory by name, to detect ambiguous matches
+	existing := map[string][]Node{}
+	for _, n := range list.Nodes {
+		existing[n.Name] = append(existing[n.Name], n)
+	}
+	type key struct{ name, board string }
+	same := map[key]int{}
+	for _, n := range inv.Nodes {
+		if b, err := lookupBoard(n.Board); err == nil {
+			same[key{n.Name, b.ID}]++
+		}
+	}
+
+	logger := internal.CreateNamedLogger("nodes")
+	for _, n := range inv.Nodes {
+		board, err := lookupBoard(n.Board)
+		if err != nil {
+			return mapping, fmt.Errorf("node %s: %v", n.Name, err)
+		}
+
+		var matches []Node
+		for _, e := range existing[n.Name] {
+			if b, err := lookupBoard(e.Board); err == nil && b.ID == board.ID {
+				matches = append(matches, e)
+			}
+		}
+		if len(existing[n.Name]) > len(matches) {
+			logger.Warnf("A node named %s exists on the server with another board, creating a new one", n.Name)
+		}
+
+		m := ImportMapping{Name: n.Name, OldSn: n.NodeSn, OldKey: n.NodeKey}
+		switch {
+		case len(matches) > 1:
+			var sns []string
+			for _, e := range matches {
+				sns = append(sns, e.NodeSn)
+			}
+			return mapping, fmt.Errorf("node %s: %d nodes of the server match its name and board (%s), rename or delete the extra ones",
+				n.Name, len(matches), strings.Join(sns, ", "))
+		case len(matches) == 1 && same[key{n.Name, board.ID}] > 1:
+			return mapping, fmt.Errorf("node %s: %d nodes of the inventory have this name and board, the node %s of the server can not be matched to one of them",
+				n.Name, same[key{n.Name, board.ID}], matches[0].NodeSn)
+		case len(matches) == 1:
+			logger.Warnf("Node %s already exists on the server as %s, skipping it", n.Name, matches[0].NodeSn)
+			m.NewSn = matches[0].NodeSn
+			m.NewKey = matches[0].NodeKey
+			m.Existing = true
+		case !dryRun:
+			resp, err := CreateNode(ctx, n.Name, board)
+			if err != nil {
+				return mapping, fmt.Errorf("node %s: %v", n.Name, err)
+			}
+			m.NewSn = resp.NodeSn
+			m.NewKey = resp.NodeKey
+		}
+
+		mapping = append(mapping, m)
+	}
+
+	return mapping, nil
+}
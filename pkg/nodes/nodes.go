@@ -2,9 +2,14 @@ package nodes
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/boards"
+	"github.com/gabeduke/wio-cli-go/pkg/device"
+	"github.com/gabeduke/wio-cli-go/pkg/labels"
 	"github.com/spf13/viper"
 	"io"
 	"net"
@@ -13,6 +18,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type CreateResp struct {
@@ -27,6 +33,7 @@ type Node struct {
 	Dataxserver interface{} `json:"dataxserver"`
 	Board       string      `json:"board"`
 	Online      bool        `json:"online"`
+	Labels      labels.Set  `json:"labels,omitempty"`
 }
 
 type ListResp struct {
@@ -53,7 +60,7 @@ func getURIFromConfig() (*url.URL, error) {
 	return url.Parse(viper.GetString(internal.HOST))
 }
 
-func RegisterNode() error {
+func RegisterNode(ctx context.Context) error {
 
 	if viper.GetBool("create") {
 		if nodeName == "" {
@@ -61,11 +68,16 @@ func RegisterNode() error {
 		}
 
 		if boardType == "" {
-			boardTypeStr := internal.Prompt("Enter the board type (node or link): ", "link")
-			boardType = boardEnum(boardTypeStr)
+			boardTypeStr := internal.Prompt("Enter the board type ("+strings.Join(boardIDs(), ", ")+"): ", "link")
+			boardType = boardFlag(boardTypeStr)
 		}
 
-		resp, err := CreateNode(nodeName, boardType)
+		board, err := lookupBoard(string(boardType))
+		if err != nil {
+			return err
+		}
+
+		resp, err := CreateNode(ctx, nodeName, board)
 		if err != nil {
 			return err
 		}
@@ -80,34 +92,30 @@ func RegisterNode() error {
 	input := bufio.NewScanner(os.Stdin)
 	input.Scan()
 
-	p := make([]byte, 2048)
-	conn, err := net.Dial("udp", internal.NODE_UDP_ADDR)
-	if err != nil {
-		return err
-	}
-
 	ssid := internal.Prompt("Enter the name of the SSID you want to connect to: ", "")
 	pass := internal.Prompt("Enter the password for the SSID: ", "")
 
-	r := fmt.Sprintf("APCFG: %s\t%s\t%s\t%s\t%s\t%s\t\r\n", ssid, pass, viper.GetString("key"), viper.GetString("sn"), viper.GetString(internal.HOST), viper.GetString(internal.HOST_IP))
-	fmt.Println(r)
-	_, err = fmt.Fprintf(conn, r)
+	reply, err := ConfigureAP(ctx, ssid, pass, viper.GetString("key"), viper.GetString("sn"))
 	if err != nil {
 		return err
 	}
-
-	_, err = bufio.NewReader(conn).Read(p)
-	if err == nil {
-		fmt.Println(string(p))
-	} else {
-		return err
-	}
-	conn.Close()
+	fmt.Println(reply)
 
 	return nil
 }
 
-func ListNodes() (ListResp, error) {
+// ConfigureAP sends the Wi-Fi credentials, node credentials and server address to a device in AP mode
+// and returns the device reply.
+func ConfigureAP(ctx context.Context, ssid, pass, key, sn string) (string, error) {
+	r := device.APConfig(ssid, pass, key, sn, viper.GetString(internal.HOST), viper.GetString(internal.HOST_IP))
+	fmt.Println(r)
+
+	// the device stores the configuration before replying
+	reply, err := device.Send(ctx, device.Addr(), r, 10*time.Second)
+	return reply.Text, err
+}
+
+func ListNodes(ctx context.Context) (ListResp, error) {
 	nodes := ListResp{}
 	ep, err := getURIFromConfig()
 	if err != nil {
@@ -116,13 +124,17 @@ func ListNodes() (ListResp, error) {
 	ep.Path = "/v1/nodes/list"
 
 	req, err := http.NewRequest("GET", ep.String(), nil)
+	if err != nil {
+		return nodes, err
+	}
 	req.Header.Add("Authorization", "token "+viper.GetString(internal.TOKEN))
 	req.Header.Add("Accept", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := internal.Do(ctx, req)
 	if err != nil {
 		return nodes, err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return nodes, fmt.Errorf("failed to list nodes: %s", resp.Status)
@@ -134,21 +146,248 @@ func ListNodes() (ListResp, error) {
 	}
 	json.Unmarshal(bodyBytes, &nodes)
 
+	all := labels.All()
+	for i, n := range nodes.Nodes {
+		nodes.Nodes[i].Labels = all[strings.ToLower(n.NodeSn)]
+	}
+
 	return nodes, nil
 }
 
-func CreateNode(name string, boardType boardEnum) (CreateResp, error) {
-	var board string
-	switch boardType {
-	case boardEnumNode:
-		board = internal.WIO_NODE_V1_0
-	case boardEnumLink:
-		board = internal.WIO_LINK_V1_0
+// FindNode looks up a node in the account by name, serial number or alias.
+func FindNode(ctx context.Context, nameOrSn string) (Node, error) {
+	list, err := ListNodes(ctx)
+	if err != nil {
+		return Node{}, err
+	}
+
+	find := func(nameOrSn string) (Node, bool) {
+		for _, n := range list.Nodes {
+			if n.NodeSn == nameOrSn || n.Name == nameOrSn {
+				return n, true
+			}
+		}
+		return Node{}, false
 	}
 
+	if n, ok := find(nameOrSn); ok {
+		return n, nil
+	}
+	if target := viper.GetString(internal.ALIASES + "." + strings.ToLower(nameOrSn)); target != "" {
+		if n, ok := find(target); ok {
+			return n, nil
+		}
+		return Node{}, fmt.Errorf("node not found: %s (alias of %s)", target, nameOrSn)
+	}
+
+	return Node{}, fmt.Errorf("node not found: %s", nameOrSn)
+}
+
+// SelectNodes returns the nodes whose local labels match the selector, with their labels set.
+func SelectNodes(ctx context.Context, selector string) ([]Node, error) {
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	// an empty selector matches every node, refuse it rather than operate on the whole fleet
+	if sel.Empty() {
+		return nil, fmt.Errorf("the selector %q has no requirements", selector)
+	}
+
+	list, err := ListNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := []Node{}
+	for _, n := range list.Nodes {
+		if sel.Matches(n.Labels) {
+			selected = append(selected, n)
+		}
+	}
+
+	return selected, nil
+}
+
+// APIError is returned when a node API call is answered with a non 200 status.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("node api call failed: %s: %s", e.Status, strings.TrimSpace(e.Body))
+}
+
+// IsTransient reports whether err is worth retrying: network errors and 5xx server responses.
+func IsTransient(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// CallNode calls a resource of the Grove drivers running on a node. Reads use GET and writes use POST,
+// path is relative to /v1/node/ (eg. GroveTempHumD0/temperature or GroveRelayD0/onoff/1).
+// Calls to a node which was put to sleep fail with an *AsleepError, unless the failure is not caused by the
+// node being unreachable, eg. a wrong path or key, which is returned as is.
+func CallNode(ctx context.Context, node Node, method, path string) (map[string]interface{}, error) {
+	until, asleep := ExpectedAsleep(node)
+	if asleep && !node.Online {
+		return nil, &AsleepError{Node: node.Name, Until: until}
+	}
+
+	result, err := callNode(ctx, node, method, path)
+	if err != nil {
+		if asleep && IsTransient(err) {
+			return nil, &AsleepError{Node: node.Name, Until: until}
+		}
+		return nil, err
+	}
+
+	if strings.EqualFold(method, "POST") {
+		recordSleep(node, path)
+	}
+
+	return result, nil
+}
+
+func callNode(ctx context.Context, node Node, method, path string) (map[string]interface{}, error) {
+	ep, err := getURIFromConfig()
+	if err != nil {
+		return nil, err
+	}
+	ep.Path = "/v1/node/" + strings.TrimPrefix(path, "/")
+
+	req, err := http.NewRequest(strings.ToUpper(method), ep.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "token "+node.NodeKey)
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := internal.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(bodyBytes)}
+	}
+
+	result := map[string]interface{}{}
+	err = json.Unmarshal(bodyBytes, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Resource is an API endpoint exposed by a Grove driver, as advertised by the node's .well-known endpoint.
+type Resource struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Args    string `json:"args,omitempty"`
+	Returns string `json:"returns,omitempty"`
+}
+
+// Instance returns the Grove driver instance of the resource, eg. GroveTempHumD0.
+func (r Resource) Instance() string {
+	return strings.SplitN(r.Path, "/", 2)[0]
+}
+
+// Property returns the property or method name of the resource, eg. temperature.
+func (r Resource) Property() string {
+	parts := strings.SplitN(r.Path, "/", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// WellKnown lists the resources exposed by the Grove drivers running on a node.
+func WellKnown(ctx context.Context, node Node) ([]Resource, error) {
+	result, err := CallNode(ctx, node, "GET", ".well-known")
+	if err != nil {
+		return nil, err
+	}
+
+	lines, ok := result["well_known"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected .well-known response: %v", result)
+	}
+
+	var resources []Resource
+	for _, l := range lines {
+		line, ok := l.(string)
+		if !ok {
+			continue
+		}
+		if r, ok := parseResource(line); ok {
+			resources = append(resources, r)
+		}
+	}
+
+	return resources, nil
+}
+
+// parseResource parses a .well-known line, eg. "GET /v1/node/GroveTempHumD0/temperature -> float celsius_degree"
+// or "POST /v1/node/GroveRelayD1/onoff/{uint8_t onoff}".
+func parseResource(line string) (Resource, bool) {
+	var r Resource
+	if i := strings.Index(line, "->"); i >= 0 {
+		r.Returns = strings.TrimSpace(line[i+2:])
+		line = line[:i]
+	}
+
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+	if len(fields) != 2 || !strings.HasPrefix(fields[1], "/v1/node/") {
+		return r, false
+	}
+	r.Method = fields[0]
+
+	path := strings.TrimSpace(strings.TrimPrefix(fields[1], "/v1/node/"))
+	if i := strings.Index(path, "/{"); i >= 0 {
+		r.Args = path[i+1:]
+		path = path[:i]
+	}
+	r.Path = path
+
+	return r, true
+}
+
+// lookupBoard finds a board by id, display name or server identifier in the board registry.
+func lookupBoard(name string) (boards.Board, error) {
+	registry, err := boards.Default()
+	if err != nil {
+		return boards.Board{}, err
+	}
+	return registry.Lookup(name)
+}
+
+func boardIDs() []string {
+	registry, err := boards.Default()
+	if err != nil {
+		return nil
+	}
+	return registry.IDs()
+}
+
+func CreateNode(ctx context.Context, name string, board boards.Board) (CreateResp, error) {
 	data := url.Values{
 		"name":  {name},
-		"board": {board},
+		"board": {board.ServerID},
 	}
 
 	ep, err := getURIFromConfig()
@@ -158,7 +397,7 @@ func CreateNode(name string, boardType boardEnum) (CreateResp, error) {
 
 	ep.Path = "/v1/nodes/create"
 
-	resp, err := postRequest(data, ep)
+	resp, err := postRequest(ctx, data, ep)
 	if err != nil {
 		return CreateResp{}, err
 	}
@@ -173,7 +412,7 @@ func CreateNode(name string, boardType boardEnum) (CreateResp, error) {
 	return registerResp, nil
 }
 
-func DeleteNode(sn string) error {
+func DeleteNode(ctx context.Context, sn string) error {
 	data := url.Values{
 		"node_sn": {sn},
 	}
@@ -185,7 +424,7 @@ func DeleteNode(sn string) error {
 
 	ep.Path = "/v1/nodes/delete"
 
-	resp, err := postRequest(data, ep)
+	resp, err := postRequest(ctx, data, ep)
 	if err != nil {
 		return err
 	}
@@ -204,7 +443,45 @@ func DeleteNode(sn string) error {
 	return nil
 }
 
-func postRequest(data url.Values, ep *url.URL) (*http.Response, error) {
+func RenameNode(ctx context.Context, sn, name string) error {
+	data := url.Values{
+		"node_sn": {sn},
+		"name":    {name},
+	}
+
+	ep, err := getURIFromConfig()
+	if err != nil {
+		return err
+	}
+
+	ep.Path = "/v1/nodes/rename"
+
+	resp, err := postRequest(ctx, data, ep)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	var renameResp deleteResp
+	err = json.NewDecoder(resp.Body).Decode(&renameResp)
+	if err != nil {
+		return err
+	}
+
+	if renameResp.Result != "ok" {
+		return fmt.Errorf("failed to rename node: %s", sn)
+	}
+
+	return nil
+}
+
+// SetDataxserver points a node at the data exchange server it streams its data to.
+func SetDataxserver(ctx context.Context, node Node, address string) error {
+	_, err := CallNode(ctx, node, "POST", "setting/dataxserver/"+address)
+	return err
+}
+
+func postRequest(ctx context.Context, data url.Values, ep *url.URL) (*http.Response, error) {
 	req, err := http.NewRequest("POST", ep.String(), strings.NewReader(data.Encode()))
 	if err != nil {
 		return &http.Response{}, err
@@ -217,11 +494,16 @@ func postRequest(data url.Values, ep *url.URL) (*http.Response, error) {
 	req.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
 
 	// send request with headers
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := internal.Do(ctx, req)
 	if err != nil {
 		return &http.Response{}, err
 	}
 
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return &http.Response{}, &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+	}
+
 	return resp, nil
 }
@@ -0,0 +1,168 @@
+package nodes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/boards"
+	"github.com/gabeduke/wio-cli-go/pkg/drivers"
+	"github.com/gabeduke/wio-cli-go/pkg/layout"
+	"io"
+	"net/http"
+	"time"
+)
+
+// otaTriggerMargin is added to the OTA timeout for the request starting the update, to bound the work on
+// each node of 'nodes ota --selector'.
+const otaTriggerMargin = time.Minute
+
+type otaConnection struct {
+	Sku  string `json:"sku"`
+	Port string `json:"port"`
+}
+
+type otaRequest struct {
+	BoardName   string          `json:"board_name"`
+	Connections []otaConnection `json:"connections"`
+}
+
+// OTAStatus is the progress of a firmware update as reported by the server.
+type OTAStatus struct {
+	Status  string `json:"ota_status"`
+	Message string `json:"ota_msg"`
+}
+
+// ValidateLayout resolves the board of a layout, which defaults to the board of the node, and checks the
+// layout against the board registry and the driver catalog.
+func ValidateLayout(node Node, l layout.Layout, catalog []drivers.Driver) (boards.Board, error) {
+	board, err := lookupBoard(node.Board)
+	if err != nil {
+		return board, err
+	}
+
+	if l.Board != "" {
+		b, err := lookupBoard(l.Board)
+		if err != nil {
+			return board, err
+		}
+		if b.ServerID != board.ServerID {
+			return board, fmt.Errorf("layout is for %s but %s is a %s", b.ServerID, node.Name, board.ServerID)
+		}
+	}
+
+	return board, l.Validate(board, catalog)
+}
+
+// TriggerOTA asks the server to build a firmware with the drivers of the layout and flash it to the node.
+func TriggerOTA(ctx context.Context, node Node, l layout.Layout, catalog []drivers.Driver) error {
+	board, err := ValidateLayout(node, l, catalog)
+	if err != nil {
+		return err
+	}
+
+	body := otaRequest{BoardName: board.ServerID, Connections: []otaConnection{}}
+	for _, c := range l.Connections {
+		d, err := drivers.Find(catalog, c.Driver)
+		if err != nil {
+			return err
+		}
+		body.Connections = append(body.Connections, otaConnection{Sku: d.SKU, Port: c.Port})
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	ep, err := getURIFromConfig()
+	if err != nil {
+		return err
+	}
+	ep.Path = "/v1/ota/trigger"
+
+	req, err := http.NewRequest("POST", ep.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "token "+node.NodeKey)
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := internal.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(b)}
+	}
+
+	return nil
+}
+
+// GetOTAStatus returns the progress of the last firmware update of the node. The server holds the
+// request until the status changes.
+func GetOTAStatus(ctx context.Context, node Node) (OTAStatus, error) {
+	var status OTAStatus
+	ep, err := getURIFromConfig()
+	if err != nil {
+		return status, err
+	}
+	ep.Path = "/v1/ota/status"
+
+	req, err := http.NewRequest("GET", ep.String(), nil)
+	if err != nil {
+		return status, err
+	}
+	req.Header.Add("Authorization", "token "+node.NodeKey)
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := internal.Do(ctx, req)
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return status, &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(b)}
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	return status, err
+}
+
+// WaitOTA polls the OTA status until the update is done, failed or timeout expired.
+func WaitOTA(ctx context.Context, node Node, timeout time.Duration, progress func(OTAStatus)) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		status, err := GetOTAStatus(ctx, node)
+		if err != nil && !IsTransient(err) {
+			return err
+		}
+
+		if err == nil {
+			if progress != nil {
+				progress(status)
+			}
+			switch status.Status {
+			case "done":
+				return nil
+			case "error":
+				return fmt.Errorf("ota failed on %s: %s", node.Name, status.Message)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	return fmt.Errorf("timed out waiting for the ota of %s", node.Name)
+}
@@ -0,0 +1,143 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sleepFile = "sleep.json"
+
+// SleepState records when a node was put to sleep, so it is expected to be offline until it wakes up.
+type SleepState struct {
+	Name  string    `json:"name"`
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+}
+
+// AsleepError is returned when calling a node which is expected to be asleep.
+type AsleepError struct {
+	Node  string
+	Until time.Time
+}
+
+func (e *AsleepError) Error() string {
+	return fmt.Sprintf("%s is asleep until %s (expected offline)", e.Node, e.Until.Format(time.RFC3339))
+}
+
+func sleepPath() (string, error) {
+	dir, err := internal.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, sleepFile), nil
+}
+
+// LoadSleepStates returns the recorded sleep of each node by serial number.
+func LoadSleepStates() (map[string]SleepState, error) {
+	states := map[string]SleepState{}
+	path, err := sleepPath()
+	if err != nil {
+		return states, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return states, nil
+	} else if err != nil {
+		return states, err
+	}
+
+	err = json.Unmarshal(data, &states)
+	return states, err
+}
+
+// updateSleepStates changes the sleep states with fn while holding the lock of the file, so the calls of a
+// fan-out do not overwrite each other's records.
+func updateSleepStates(fn func(states map[string]SleepState)) error {
+	path, err := sleepPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	unlock, err := internal.LockFile(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	states, err := LoadSleepStates()
+	if err != nil {
+		internal.CreateNamedLogger("nodes").Warnf("Unable to read the sleep state, starting over: %v", err)
+		states = map[string]SleepState{}
+	}
+	fn(states)
+
+	// forget nodes which woke up
+	for sn, s := range states {
+		if time.Now().After(s.Until) {
+			delete(states, sn)
+		}
+	}
+
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return internal.WriteFileAtomic(path, data, 0600)
+}
+
+// ExpectedAsleep reports whether the node was put to sleep and when it is expected to wake up.
+func ExpectedAsleep(node Node) (time.Time, bool) {
+	states, err := LoadSleepStates()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	s, ok := states[node.NodeSn]
+	if !ok || time.Now().After(s.Until) {
+		return time.Time{}, false
+	}
+	return s.Until, true
+}
+
+// recordSleep remembers successful pm/sleep calls, whichever command made them.
+func recordSleep(node Node, path string) {
+	path = strings.Trim(path, "/")
+	if !strings.HasPrefix(path, "pm/sleep/") {
+		return
+	}
+
+	seconds, err := strconv.Atoi(strings.TrimPrefix(path, "pm/sleep/"))
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	err = updateSleepStates(func(states map[string]SleepState) {
+		states[node.NodeSn] = SleepState{Name: node.Name, Since: now, Until: now.Add(time.Duration(seconds) * time.Second)}
+	})
+	if err != nil {
+		internal.CreateNamedLogger("nodes").Warnf("Unable to write the sleep state: %v", err)
+	}
+}
+
+// Sleep puts the node into deep sleep, it wakes up and reconnects once d elapsed.
+func Sleep(ctx context.Context, node Node, d time.Duration) error {
+	seconds := int(d.Round(time.Second).Seconds())
+	if seconds <= 0 {
+		return fmt.Errorf("sleep duration must be at least one second")
+	}
+
+	_, err := CallNode(ctx, node, "POST", fmt.Sprintf("pm/sleep/%d", seconds))
+	return err
+}
@@ -0,0 +1,286 @@
+package nodes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/drivers"
+	"github.com/gabeduke/wio-cli-go/pkg/fanout"
+	"github.com/gabeduke/wio-cli-go/pkg/layout"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	rolloutPending = "pending"
+	rolloutDone    = "done"
+	rolloutFailed  = "failed"
+)
+
+// RolloutOptions control a staged OTA rollout.
+type RolloutOptions struct {
+	Name           string
+	Canary         int
+	Batch          int
+	MaxFailureRate float64
+	OTATimeout     time.Duration
+	OnlineTimeout  time.Duration
+	Restart        bool
+}
+
+// RolloutNode is the progress of one node of a rollout.
+type RolloutNode struct {
+	Name   string    `json:"name"`
+	NodeSn string    `json:"node_sn"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	Batch  int       `json:"batch"`
+	Ended  time.Time `json:"ended,omitempty"`
+}
+
+// Rollout is the state of a staged OTA rollout, persisted after every batch so it can be resumed.
+type Rollout struct {
+	Name       string        `json:"name"`
+	LayoutHash string        `json:"layout_hash"`
+	Started    time.Time     `json:"started"`
+	Halted     string        `json:"halted,omitempty"`
+	Nodes      []RolloutNode `json:"nodes"`
+}
+
+func rolloutPath(name string) (string, error) {
+	dir, err := internal.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "rollouts")
+	return filepath.Join(dir, name+".json"), os.MkdirAll(dir, 0700)
+}
+
+func loadRollout(name string) (*Rollout, error) {
+	path, err := rolloutPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var r Rollout
+	return &r, json.Unmarshal(data, &r)
+}
+
+func (r *Rollout) save() error {
+	path, err := rolloutPath(r.Name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func (r *Rollout) count(status string) int {
+	n := 0
+	for _, node := range r.Nodes {
+		if node.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func layoutHash(l layout.Layout) string {
+	l.Sort()
+	data, _ := json.Marshal(l.Connections)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// StartRollout updates the nodes in stages: the canary nodes first, then batches of opts.Batch nodes. Every
+// updated node must come back online and advertise the drivers of the layout. The rollout halts when a
+// canary fails or when the failure rate of the updated nodes exceeds opts.MaxFailureRate. The state is
+// saved after each batch; running the same rollout again resumes with the pending and failed nodes, and the
+// nodes which matched the selector since, updated last.
+func StartRollout(ctx context.Context, targets []Node, l layout.Layout, catalog []drivers.Driver, opts RolloutOptions, progress func(string)) (*Rollout, error) {
+	if opts.Batch < 1 || opts.Canary < 0 {
+		return nil, fmt.Errorf("the batch size must be positive and the canary count can not be negative")
+	}
+
+	for _, n := range targets {
+		if _, err := ValidateLayout(n, l, catalog); err != nil {
+			return nil, fmt.Errorf("%s: %v", n.Name, err)
+		}
+	}
+
+	hash := layoutHash(l)
+	r, err := loadRollout(opts.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if r != nil && !opts.Restart {
+		if r.LayoutHash != hash {
+			return nil, fmt.Errorf("rollout %s was started with another layout, use --restart to start over", opts.Name)
+		}
+		progress(fmt.Sprintf("Resuming rollout %s: %d done, retrying %d failed, %d pending", r.Name, r.count(rolloutDone), r.count(rolloutFailed), r.count(rolloutPending)))
+		r.Halted = ""
+		for i := range r.Nodes {
+			if r.Nodes[i].Status == rolloutFailed {
+				r.Nodes[i].Status = rolloutPending
+				r.Nodes[i].Error = ""
+			}
+		}
+
+		// nodes which matched the selector since the rollout started are updated after the others
+		known := map[string]bool{}
+		for _, n := range r.Nodes {
+			known[n.NodeSn] = true
+		}
+		var added []string
+		for _, n := range targets {
+			if !known[n.NodeSn] {
+				r.Nodes = append(r.Nodes, RolloutNode{Name: n.Name, NodeSn: n.NodeSn, Status: rolloutPending})
+				added = append(added, n.Name)
+			}
+		}
+		if len(added) > 0 {
+			progress(fmt.Sprintf("Adding %d nodes which now match the selector: %s", len(added), strings.Join(added, ", ")))
+		}
+	} else {
+		r = &Rollout{Name: opts.Name, LayoutHash: hash, Started: time.Now()}
+		for _, n := range targets {
+			r.Nodes = append(r.Nodes, RolloutNode{Name: n.Name, NodeSn: n.NodeSn, Status: rolloutPending})
+		}
+	}
+
+	bySn := map[string]Node{}
+	for _, n := range targets {
+		bySn[n.NodeSn] = n
+	}
+
+	batch := 0
+	for r.count(rolloutPending) > 0 {
+		size := opts.Batch
+		canary := r.count(rolloutDone)+r.count(rolloutFailed) < opts.Canary
+		if canary {
+			size = opts.Canary - r.count(rolloutDone) - r.count(rolloutFailed)
+		}
+		batch++
+
+		var indexes []int
+		for i, n := range r.Nodes {
+			if n.Status == rolloutPending && len(indexes) < size {
+				if _, ok := bySn[n.NodeSn]; !ok {
+					r.Nodes[i].Status = rolloutFailed
+					r.Nodes[i].Error = "node no longer matches the selector"
+					continue
+				}
+				indexes = append(indexes, i)
+			}
+		}
+		if len(indexes) == 0 {
+			continue
+		}
+
+		stage := "batch"
+		if canary {
+			stage = "canary"
+		}
+		var names []string
+		for _, i := range indexes {
+			names = append(names, r.Nodes[i].Name)
+		}
+		progress(fmt.Sprintf("Updating %s %d: %s", stage, batch, strings.Join(names, ", ")))
+
+		summary := fanout.Run(ctx, indexes, func(i int) string { return r.Nodes[i].Name }, fanout.Options{Parallel: len(indexes)},
+			func(ctx context.Context, i int) (interface{}, error) {
+				return nil, updateAndVerify(ctx, bySn[r.Nodes[i].NodeSn], l, catalog, opts)
+			})
+
+		for j, res := range summary {
+			i := indexes[j]
+			r.Nodes[i].Batch = batch
+			r.Nodes[i].Ended = time.Now()
+			if res.OK {
+				r.Nodes[i].Status = rolloutDone
+			} else {
+				r.Nodes[i].Status = rolloutFailed
+				r.Nodes[i].Error = res.Error
+			}
+			progress(fmt.Sprintf("  %s: %s %s", r.Nodes[i].Name, r.Nodes[i].Status, r.Nodes[i].Error))
+		}
+
+		failed := r.count(rolloutFailed)
+		rate := float64(failed) / float64(failed+r.count(rolloutDone))
+		if canary && summary.Failed() {
+			r.Halted = "a canary node failed"
+		} else if rate > opts.MaxFailureRate {
+			r.Halted = fmt.Sprintf("failure rate %.0f%% exceeds %.0f%%", rate*100, opts.MaxFailureRate*100)
+		}
+
+		if err := r.save(); err != nil {
+			return r, err
+		}
+		if r.Halted != "" {
+			return r, fmt.Errorf("rollout %s halted: %s", r.Name, r.Halted)
+		}
+	}
+
+	return r, r.save()
+}
+
+// updateAndVerify updates a node and checks it comes back online with the drivers of the layout.
+func updateAndVerify(ctx context.Context, node Node, l layout.Layout, catalog []drivers.Driver, opts RolloutOptions) error {
+	if err := TriggerOTA(ctx, node, l, catalog); err != nil {
+		return err
+	}
+	if err := WaitOTA(ctx, node, opts.OTATimeout, nil); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(opts.OnlineTimeout)
+	for {
+		current, err := FindNode(ctx, node.NodeSn)
+		if err == nil && current.Online {
+			node = current
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("did not come back online within %s", opts.OnlineTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+
+	resources, err := WellKnown(ctx, node)
+	if err != nil {
+		return fmt.Errorf("reading resources: %v", err)
+	}
+
+	running := layout.Layout{Connections: groveLayout(resources)}
+	desired := layout.Layout{Connections: l.Connections}
+	if changes := layout.Diff(running, desired); len(changes) > 0 {
+		var diffs []string
+		for _, c := range changes {
+			diffs = append(diffs, c.String())
+		}
+		return fmt.Errorf("resources do not match the layout: %s", strings.Join(diffs, "; "))
+	}
+
+	return nil
+}
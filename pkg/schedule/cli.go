@@ -0,0 +1,114 @@
+package schedule
+
+import (
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/spf13/cobra"
+)
+
+func NewScheduleCmd() *cobra.Command {
+	var scheduleCmd = &cobra.Command{
+		Use:   "schedule",
+		Short: "Run node calls on a cron schedule",
+		Long: `Schedules are persisted in the schedules.json file next to the configuration file and are executed by
+'wio schedule run', which stays in the foreground and should be supervised (eg. by systemd).
+
+Schedules use the standard 5 field cron syntax (minute hour day-of-month month day-of-week) or descriptors
+such as @hourly and @every 10m.`,
+	}
+
+	scheduleCmd.AddCommand(newScheduleAddCmd())
+	scheduleCmd.AddCommand(newScheduleListCmd())
+	scheduleCmd.AddCommand(newScheduleRemoveCmd())
+	scheduleCmd.AddCommand(newScheduleRunCmd())
+
+	return scheduleCmd
+}
+
+func newScheduleAddCmd() *cobra.Command {
+	var spec, node, method, path string
+	var scheduleAddCmd = &cobra.Command{
+		Use:   "add",
+		Short: "Add a scheduled node call",
+		Example: `  wio schedule add --cron "0 7 * * *" --node greenhouse --method POST --path GroveRelayD0/onoff/1
+  wio schedule add --cron "0 19 * * *" --node greenhouse --method POST --path GroveRelayD0/onoff/0`,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("schedule")
+			job, err := Add(spec, node, method, path)
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			fmt.Println("Schedule added: " + job.ID)
+		},
+	}
+
+	scheduleAddCmd.Flags().StringVar(&spec, "cron", "", "Cron expression")
+	scheduleAddCmd.Flags().StringVarP(&node, "node", "n", "", "Name or serial number of the node")
+	scheduleAddCmd.Flags().StringVarP(&method, "method", "m", "GET", `HTTP method: "GET" to read, "POST" to write`)
+	scheduleAddCmd.Flags().StringVarP(&path, "path", "p", "", "Resource path, eg. GroveRelayD0/onoff/1")
+
+	cobra.MarkFlagRequired(scheduleAddCmd.Flags(), "cron")
+	cobra.MarkFlagRequired(scheduleAddCmd.Flags(), "node")
+	cobra.MarkFlagRequired(scheduleAddCmd.Flags(), "path")
+
+	return scheduleAddCmd
+}
+
+func newScheduleListCmd() *cobra.Command {
+	var scheduleListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List scheduled node calls",
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("schedule")
+			jobs, err := Load()
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			fmt.Println(jobs)
+		},
+	}
+
+	return scheduleListCmd
+}
+
+func newScheduleRemoveCmd() *cobra.Command {
+	var scheduleRemoveCmd = &cobra.Command{
+		Use:     "remove <id>",
+		Short:   "Remove a scheduled node call",
+		Aliases: []string{"rm", "delete"},
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("schedule")
+			err := Remove(args[0])
+			if err != nil {
+				logger.Fatal(err)
+			}
+
+			fmt.Println("Schedule removed: " + args[0])
+		},
+	}
+
+	return scheduleRemoveCmd
+}
+
+func newScheduleRunCmd() *cobra.Command {
+	var retries int
+	var scheduleRunCmd = &cobra.Command{
+		Use:   "run",
+		Short: "Execute scheduled node calls in the foreground",
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("schedule")
+
+			err := Run(cmd.Context(), logger, retries)
+			if err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	scheduleRunCmd.Flags().IntVar(&retries, "retries", 3, "Number of retries for transient failures")
+
+	return scheduleRunCmd
+}
@@ -0,0 +1,205 @@
+package schedule
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/nodes"
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const scheduleFile = "schedules.json"
+
+// Job is a node call executed on a cron schedule.
+type Job struct {
+	ID      string    `json:"id"`
+	Spec    string    `json:"spec"`
+	Node    string    `json:"node"`
+	Method  string    `json:"method"`
+	Path    string    `json:"path"`
+	Created time.Time `json:"created"`
+}
+
+type Jobs struct {
+	Jobs []Job `json:"jobs"`
+}
+
+func (j Jobs) String() string {
+	b, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+	}
+	return string(b)
+}
+
+var parser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+func schedulePath() (string, error) {
+	dir, err := internal.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, scheduleFile), nil
+}
+
+// Load reads the persisted jobs, an absent file is an empty schedule.
+func Load() (Jobs, error) {
+	jobs := Jobs{}
+	path, err := schedulePath()
+	if err != nil {
+		return jobs, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return jobs, nil
+	} else if err != nil {
+		return jobs, err
+	}
+
+	err = json.Unmarshal(data, &jobs)
+	return jobs, err
+}
+
+func (j Jobs) save() error {
+	path, err := schedulePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Add validates and persists a new job.
+func Add(spec, node, method, path string) (Job, error) {
+	method = strings.ToUpper(method)
+	if method != "GET" && method != "POST" {
+		return Job{}, fmt.Errorf("method must be GET or POST: %s", method)
+	}
+
+	if _, err := parser.Parse(spec); err != nil {
+		return Job{}, fmt.Errorf("invalid cron spec %q: %v", spec, err)
+	}
+
+	jobs, err := Load()
+	if err != nil {
+		return Job{}, err
+	}
+
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return Job{}, err
+	}
+
+	job := Job{
+		ID:      hex.EncodeToString(id),
+		Spec:    spec,
+		Node:    node,
+		Method:  method,
+		Path:    path,
+		Created: time.Now(),
+	}
+	jobs.Jobs = append(jobs.Jobs, job)
+
+	return job, jobs.save()
+}
+
+// Remove deletes a persisted job by id.
+func Remove(id string) error {
+	jobs, err := Load()
+	if err != nil {
+		return err
+	}
+
+	for i, job := range jobs.Jobs {
+		if job.ID == id {
+			jobs.Jobs = append(jobs.Jobs[:i], jobs.Jobs[i+1:]...)
+			return jobs.save()
+		}
+	}
+
+	return fmt.Errorf("schedule not found: %s", id)
+}
+
+// Run executes the persisted jobs at their scheduled times until ctx is cancelled.
+func Run(ctx context.Context, logger *log.Entry, retries int) error {
+	jobs, err := Load()
+	if err != nil {
+		return err
+	}
+
+	if len(jobs.Jobs) == 0 {
+		return fmt.Errorf("no schedules defined, add one with `wio schedule add`")
+	}
+
+	c := cron.New(cron.WithParser(parser))
+	for _, job := range jobs.Jobs {
+		job := job
+		_, err := c.AddFunc(job.Spec, func() {
+			execute(ctx, logger.WithField("id", job.ID), job, retries)
+		})
+		if err != nil {
+			return fmt.Errorf("invalid cron spec %q for schedule %s: %v", job.Spec, job.ID, err)
+		}
+		logger.WithField("id", job.ID).WithField("spec", job.Spec).Infof("Scheduled %s %s on %s", job.Method, job.Path, job.Node)
+	}
+
+	c.Start()
+	<-ctx.Done()
+	<-c.Stop().Done()
+
+	return nil
+}
+
+// execute calls the node the same way `nodes call` does, retrying transient failures with a linear backoff.
+func execute(ctx context.Context, logger *log.Entry, job Job, retries int) {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(attempt) * 5 * time.Second):
+			}
+		}
+
+		var node nodes.Node
+		node, err = nodes.FindNode(ctx, job.Node)
+		if err == nil {
+			var result map[string]interface{}
+			result, err = nodes.CallNode(ctx, node, job.Method, job.Path)
+			if err == nil {
+				data, _ := json.Marshal(result)
+				fmt.Printf("%s [%s] %s %s on %s: %s\n", time.Now().Format(time.RFC3339), job.ID, job.Method, job.Path, job.Node, data)
+				return
+			}
+		}
+
+		var asleep *nodes.AsleepError
+		if errors.As(err, &asleep) {
+			logger.Info(asleep)
+			fmt.Printf("%s [%s] %s %s on %s: skipped, %v\n", time.Now().Format(time.RFC3339), job.ID, job.Method, job.Path, job.Node, asleep)
+			return
+		}
+
+		if !nodes.IsTransient(err) {
+			break
+		}
+		logger.WithField("attempt", attempt+1).Info(err)
+	}
+
+	logger.Errorf("%s %s on %s failed: %v", job.Method, job.Path, job.Node, err)
+}
@@ -0,0 +1,26 @@
+package shell
+
+import (
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func NewShellCmd() *cobra.Command {
+	var shellCmd = &cobra.Command{
+		Use:   "shell",
+		Short: "Interactive shell for exploring your nodes",
+		Long: `Start an interactive shell which keeps the node list and the resources of visited nodes cached for the
+whole session. Node names, Grove drivers and properties are completed with TAB and the command history is kept
+in shell_history next to the configuration file. Type help inside the shell for a list of commands.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("shell")
+			err := New(logger, os.Stdout).Run()
+			if err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	return shellCmd
+}
@@ -0,0 +1,356 @@
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/chzyer/readline"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/nodes"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const historyFile = "shell_history"
+
+var commands = []string{"help", "nodes", "refresh", "use", "resources", "get", "set", "call", "exit"}
+
+const usage = `Commands:
+  nodes                         list the nodes of the account
+  refresh                       reload the node list and resource cache
+  use <node>                    select a node by name or serial number
+  resources                     list the resources of the selected node
+  get <property>                read a property, eg. get temperature
+  get <driver> <property>       read a property of a specific driver, eg. get GroveTempHumD0 humidity
+  set <driver> <method> [args]  write a property, eg. set relay onoff 1
+  call <GET|POST> <path>        call any resource path, eg. call GET GroveTempHumD0/temperature
+  exit                          leave the shell`
+
+// Shell is an interactive session which keeps the node list and the resources of visited nodes cached.
+// ctx lives as long as the session and is used by the completion, each command gets its own context.
+type Shell struct {
+	ctx       context.Context
+	logger    *log.Entry
+	out       io.Writer
+	nodes     []nodes.Node
+	current   *nodes.Node
+	resources map[string][]nodes.Resource
+}
+
+func New(logger *log.Entry, out io.Writer) *Shell {
+	return &Shell{ctx: context.Background(), logger: logger, out: out, resources: map[string][]nodes.Resource{}}
+}
+
+// Run reads commands until EOF or exit.
+func (s *Shell) Run() error {
+	var history string
+	if dir, err := internal.ConfigDir(); err == nil {
+		history = filepath.Join(dir, historyFile)
+	}
+
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:          "wio> ",
+		HistoryFile:     history,
+		AutoComplete:    s,
+		InterruptPrompt: "^C",
+		EOFPrompt:       "exit",
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+
+	if err := s.refresh(s.ctx); err != nil {
+		fmt.Fprintln(s.out, err)
+	}
+
+	for {
+		line, err := rl.Readline()
+		if err == readline.ErrInterrupt {
+			continue
+		} else if err != nil {
+			return nil
+		}
+
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" {
+			return nil
+		}
+
+		// Ctrl-C cancels the running command and returns to the prompt
+		ctx, stop := signal.NotifyContext(s.ctx, os.Interrupt)
+		if err := s.Exec(ctx, args); err != nil {
+			fmt.Fprintln(s.out, "error:", err)
+		}
+		stop()
+
+		if s.current != nil {
+			rl.SetPrompt(fmt.Sprintf("wio:%s> ", s.current.Name))
+		}
+	}
+}
+
+// Exec runs a single shell command.
+func (s *Shell) Exec(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "help", "?":
+		fmt.Fprintln(s.out, usage)
+	case "nodes", "ls":
+		w := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSN\tBOARD\tONLINE")
+		for _, n := range s.nodes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", n.Name, n.NodeSn, n.Board, n.Online)
+		}
+		return w.Flush()
+	case "refresh":
+		return s.refresh(ctx)
+	case "use":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: use <node>")
+		}
+		for i, n := range s.nodes {
+			if n.Name == args[1] || n.NodeSn == args[1] {
+				s.current = &s.nodes[i]
+				return nil
+			}
+		}
+		return fmt.Errorf("node not found: %s", args[1])
+	case "resources":
+		resources, err := s.currentResources(ctx)
+		if err != nil {
+			return err
+		}
+		for _, r := range resources {
+			fmt.Fprintf(s.out, "%-5s %s %s %s\n", r.Method, r.Path, r.Args, r.Returns)
+		}
+	case "get":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: get [driver] <property>")
+		}
+		path, err := s.resolve(ctx, "GET", args[1:])
+		if err != nil {
+			return err
+		}
+		return s.call(ctx, "GET", path)
+	case "set":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: set <driver> <method> [args]")
+		}
+		path, err := s.resolve(ctx, "POST", args[1:])
+		if err != nil {
+			return err
+		}
+		return s.call(ctx, "POST", path)
+	case "call":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: call <GET|POST> <path>")
+		}
+		return s.call(ctx, args[1], args[2])
+	default:
+		return fmt.Errorf("unknown command %q, type help for a list of commands", args[0])
+	}
+
+	return nil
+}
+
+func (s *Shell) refresh(ctx context.Context) error {
+	list, err := nodes.ListNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.nodes = list.Nodes
+	s.resources = map[string][]nodes.Resource{}
+	if s.current != nil {
+		sn := s.current.NodeSn
+		s.current = nil
+		for i := range s.nodes {
+			if s.nodes[i].NodeSn == sn {
+				s.current = &s.nodes[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Shell) currentResources(ctx context.Context) ([]nodes.Resource, error) {
+	if s.current == nil {
+		return nil, fmt.Errorf("no node selected, select one with: use <node>")
+	}
+
+	if resources, ok := s.resources[s.current.NodeSn]; ok {
+		return resources, nil
+	}
+
+	resources, err := nodes.WellKnown(ctx, *s.current)
+	if err != nil {
+		return nil, err
+	}
+	s.resources[s.current.NodeSn] = resources
+	return resources, nil
+}
+
+// resolve finds the resource path matching the words typed by the user. For GET the words are
+// [driver] property, for POST they are driver method [args...]. Drivers match case-insensitively on
+// a substring of the instance name so "relay" matches GroveRelayD1.
+func (s *Shell) resolve(ctx context.Context, method string, words []string) (string, error) {
+	resources, err := s.currentResources(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var driver, property string
+	var rest []string
+	if method == "GET" && len(words) == 1 {
+		property = words[0]
+	} else {
+		driver, property, rest = words[0], words[1], words[2:]
+	}
+
+	var matches []nodes.Resource
+	for _, r := range resources {
+		if r.Method != method || r.Property() != property {
+			continue
+		}
+		if driver != "" && !strings.Contains(strings.ToLower(r.Instance()), strings.ToLower(driver)) {
+			continue
+		}
+		matches = append(matches, r)
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no %s resource matches %s", method, strings.Join(words, " "))
+	case 1:
+		return strings.Join(append([]string{matches[0].Path}, rest...), "/"), nil
+	default:
+		var paths []string
+		for _, m := range matches {
+			paths = append(paths, m.Path)
+		}
+		return "", fmt.Errorf("ambiguous, matches %s", strings.Join(paths, ", "))
+	}
+}
+
+func (s *Shell) call(ctx context.Context, method, path string) error {
+	if s.current == nil {
+		return fmt.Errorf("no node selected, select one with: use <node>")
+	}
+
+	result, err := nodes.CallNode(ctx, *s.current, method, path)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "%s\n", data)
+	return nil
+}
+
+// Do implements readline.AutoCompleter, completing commands, node names, drivers and properties.
+func (s *Shell) Do(line []rune, pos int) ([][]rune, int) {
+	typed := string(line[:pos])
+	words := strings.Fields(typed)
+
+	prefix := ""
+	if len(words) > 0 && !strings.HasSuffix(typed, " ") {
+		prefix = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	candidates := s.candidates(words)
+	sort.Strings(candidates)
+
+	var out [][]rune
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			out = append(out, []rune(c[len(prefix):]+" "))
+		}
+	}
+	return out, len([]rune(prefix))
+}
+
+// candidates returns the completions for the word following words.
+func (s *Shell) candidates(words []string) []string {
+	if len(words) == 0 {
+		return commands
+	}
+
+	resources := func() []nodes.Resource {
+		if s.current == nil {
+			return nil
+		}
+		if r, ok := s.resources[s.current.NodeSn]; ok {
+			return r
+		}
+		r, err := s.currentResources(s.ctx)
+		if err != nil {
+			s.logger.Debug(err)
+		}
+		return r
+	}
+
+	unique := func(values []string) []string {
+		seen := map[string]bool{}
+		var out []string
+		for _, v := range values {
+			if v != "" && !seen[v] {
+				seen[v] = true
+				out = append(out, v)
+			}
+		}
+		return out
+	}
+
+	var out []string
+	switch {
+	case words[0] == "use" && len(words) == 1:
+		for _, n := range s.nodes {
+			out = append(out, n.Name)
+		}
+	case words[0] == "get" && len(words) == 1:
+		for _, r := range resources() {
+			if r.Method == "GET" {
+				out = append(out, r.Property(), r.Instance())
+			}
+		}
+	case words[0] == "get" && len(words) == 2, words[0] == "set" && len(words) == 2:
+		method := strings.ToUpper(words[0])
+		if method == "SET" {
+			method = "POST"
+		}
+		for _, r := range resources() {
+			if r.Method == method && r.Instance() == words[1] {
+				out = append(out, r.Property())
+			}
+		}
+	case words[0] == "set" && len(words) == 1:
+		for _, r := range resources() {
+			if r.Method == "POST" {
+				out = append(out, r.Instance())
+			}
+		}
+	case words[0] == "call" && len(words) == 1:
+		out = []string{"GET", "POST"}
+	case words[0] == "call" && len(words) == 2:
+		for _, r := range resources() {
+			if r.Method == strings.ToUpper(words[1]) {
+				out = append(out, r.Path)
+			}
+		}
+	}
+
+	return unique(out)
+}
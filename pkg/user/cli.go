@@ -26,7 +26,7 @@ func newUserCreateCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			logger := internal.CreateNamedLogger("user")
 			credentials := &credentials{}
-			_, err := credentials.Create(logger)
+			_, err := credentials.Create(cmd.Context(), logger)
 			if err != nil {
 				logger.Fatal(err)
 			}
@@ -50,19 +50,21 @@ func NewUserLoginCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			logger := internal.CreateNamedLogger("user")
 			resp := &LoginResponse{}
-			err := resp.Login(logger)
+			err := resp.Login(cmd.Context(), logger)
 			if err != nil {
 				logger.Fatal(err)
 			}
 
-			viper.Set("token", resp.Token)
-
-			err = viper.WriteConfig()
+			err = internal.UpdateConfigValues(map[string]interface{}{
+				internal.ProfileKey(internal.TOKEN): resp.Token,
+				internal.ProfileKey(internal.EMAIL): viper.GetString(internal.EMAIL),
+			})
 			if err != nil {
 				logger.Fatal(err)
 			}
 
-			fmt.Printf("Login successful. Writing token to %s\n", viper.ConfigFileUsed())
+			path, _ := internal.ConfigFile()
+			fmt.Printf("Login successful. Writing token to %s\n", path)
 		},
 	}
 
@@ -88,7 +90,7 @@ The configuration file is used to store your
 This command will Prompt you for the above information and store it in the configuration file.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			logger := internal.CreateNamedLogger("user")
-			err := configure(logger)
+			err := configure(cmd.Context(), logger)
 			if err != nil {
 				logger.Fatal(err)
 			}
@@ -2,6 +2,7 @@ package user
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/gabeduke/wio-cli-go/internal"
@@ -29,7 +30,7 @@ type credentials struct {
 	Password string `json:"password"`
 }
 
-func (c *credentials) Create(logger *log.Entry) (*CreateResponse, error) {
+func (c *credentials) Create(ctx context.Context, logger *log.Entry) (*CreateResponse, error) {
 	logger.Debug("creating user")
 
 	c.getEmail(logger)
@@ -47,32 +48,41 @@ func (c *credentials) Create(logger *log.Entry) (*CreateResponse, error) {
 	ep := viper.GetString(internal.HOST) + "/v1/user/Create"
 
 	req, err := http.NewRequest("POST", ep, bytes.NewBuffer(d))
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := internal.Do(ctx, req)
 	if err != nil {
-		logger.Fatal(err)
+		return nil, errors.Wrap(err, "Create failed")
 	}
 
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body) // response body is []byte
+	if err != nil {
+		return nil, err
+	}
 
 	logger.WithField("status", resp.Status).Debug("Create")
 	logger.WithField("headers", resp.Header).Trace("Create")
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Create failed: %v", resp.Status)
+	}
+
 	var r CreateResponse
 	err = json.Unmarshal(body, &r)
 	if err != nil {
 		return nil, err
 	}
 
-	logger.WithField("token", r.Token).Info("Create successful")
+	logger.Info("Create successful")
 
 	return &r, nil
 }
 
-func (r *LoginResponse) Login(logger *log.Entry) error {
+func (r *LoginResponse) Login(ctx context.Context, logger *log.Entry) error {
 	var usr credentials
 
 	usr.getEmail(logger)
@@ -90,20 +100,25 @@ func (r *LoginResponse) Login(logger *log.Entry) error {
 
 	ep := viper.GetString(internal.HOST) + "/v1/user/login"
 	req, err := http.NewRequest("POST", ep, bytes.NewBuffer(d))
+	if err != nil {
+		return err
+	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := internal.Do(ctx, req)
 	if err != nil {
-		panic(err)
+		return errors.Wrap(err, "Login failed")
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		return errors.Errorf("Login failed: %v", resp.Status)
 	}
 
-	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body) // response body is []byte
+	if err != nil {
+		return err
+	}
 
 	logger.WithField("status", resp.Status).Debug("Login")
 	logger.WithField("headers", resp.Header).Trace("Login")
@@ -114,7 +129,7 @@ func (r *LoginResponse) Login(logger *log.Entry) error {
 	}
 
 	viper.Set(internal.TOKEN, r.Token)
-	logger.WithField("token", r.Token).WithField("user_id", r.UserId).Info("Login successful")
+	logger.WithField("user_id", r.UserId).Info("Login successful")
 
 	return nil
 }
@@ -125,7 +140,6 @@ func (c *credentials) getPassword(logger *log.Entry) error {
 
 	c.Password = string(password)
 
-	logger.Debugf("Password: %s", password)
 	return err
 }
 
@@ -139,7 +153,7 @@ func (c *credentials) getEmail(logger *log.Entry) {
 	logger.Infof("Email: %s", c.Email)
 }
 
-func configure(logger *log.Entry) error {
+func configure(ctx context.Context, logger *log.Entry) error {
 	logger.Debug("configure called")
 
 	// Prompt for server address
@@ -162,12 +176,29 @@ func configure(logger *log.Entry) error {
 	viper.Set(internal.HOST_IP, mip)
 
 	u := LoginResponse{}
-	u.Login(logger)
+	if err := u.Login(ctx, logger); err != nil {
+		return err
+	}
 
 	viper.Set(internal.TOKEN, u.Token)
 
-	logger.Debugf("Wio CLI Configuration: %v", viper.AllSettings())
-	logger.WithField("file", viper.ConfigFileUsed()).Info("Wio CLI Configuration file updated")
+	var ip interface{}
+	if mip != "" {
+		ip = mip
+	}
+	err := internal.UpdateConfigValues(map[string]interface{}{
+		internal.ProfileKey(internal.HOST):    viper.GetString(internal.HOST),
+		internal.ProfileKey(internal.HOST_IP): ip,
+		internal.ProfileKey(internal.TOKEN):   u.Token,
+		internal.ProfileKey(internal.EMAIL):   viper.GetString(internal.EMAIL),
+	})
+	if err != nil {
+		return err
+	}
+
+	path, _ := internal.ConfigFile()
+	logger.Debugf("Wio CLI Configuration: %v", internal.Redact(viper.AllSettings()))
+	logger.WithField("file", path).Info("Wio CLI Configuration file updated")
 
-	return viper.WriteConfigAs(viper.ConfigFileUsed())
+	return nil
 }
@@ -0,0 +1,85 @@
+package watch
+
+import (
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"time"
+)
+
+func NewWatchCmd() *cobra.Command {
+	var watchCmd = &cobra.Command{
+		Use:   "watch",
+		Short: "Watch your wio resources and send notifications",
+	}
+
+	watchCmd.AddCommand(newWatchNodesCmd())
+
+	return watchCmd
+}
+
+func newWatchNodesCmd() *cobra.Command {
+	var watchNodesCmd = &cobra.Command{
+		Use:   "nodes",
+		Short: "Notify when nodes go online or offline",
+		Long: `Poll the node list and notify when a node goes online or offline for longer than the grace period.
+
+Notifications are sent to generic webhooks (JSON body), Slack compatible incoming webhooks and email. All
+settings may also be stored in the configuration file under the "watch" key, eg. "watch": {"slack": ["https://..."]}.
+The last notified state of each node is kept in watch-state.json next to the configuration file so a restart
+does not re-alert. The SMTP password is read from "watch.email.password" in the configuration file.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			logger := internal.CreateNamedLogger("watch")
+
+			w := &Watcher{
+				Interval: viper.GetDuration("watch.interval"),
+				Grace:    viper.GetDuration("watch.grace"),
+			}
+			if w.Interval <= 0 {
+				logger.Fatalf("the polling interval must be positive, got %q", viper.GetString("watch.interval"))
+			}
+			if w.Grace <= 0 {
+				logger.Fatalf("the grace period must be positive, got %q", viper.GetString("watch.grace"))
+			}
+			for _, url := range viper.GetStringSlice("watch.webhook") {
+				w.Notifiers = append(w.Notifiers, Webhook{URL: url})
+			}
+			for _, url := range viper.GetStringSlice("watch.slack") {
+				w.Notifiers = append(w.Notifiers, Slack{URL: url})
+			}
+			if to := viper.GetStringSlice("watch.email.to"); len(to) > 0 {
+				w.Notifiers = append(w.Notifiers, Email{
+					Addr:     viper.GetString("watch.email.smtp"),
+					Username: viper.GetString("watch.email.username"),
+					Password: viper.GetString("watch.email.password"),
+					From:     viper.GetString("watch.email.from"),
+					To:       to,
+				})
+			}
+
+			err := w.Run(cmd.Context(), logger)
+			if err != nil {
+				logger.Fatal(err)
+			}
+		},
+	}
+
+	watchNodesCmd.Flags().Duration("interval", time.Minute, "Polling interval")
+	watchNodesCmd.Flags().Duration("grace", 5*time.Minute, "How long a node must stay in its new state before notifying")
+	watchNodesCmd.Flags().StringSlice("webhook", nil, "Generic webhook URL, may be repeated")
+	watchNodesCmd.Flags().StringSlice("slack", nil, "Slack compatible incoming webhook URL, may be repeated")
+	watchNodesCmd.Flags().String("smtp", "", "SMTP server address (host:port) for email notifications")
+	watchNodesCmd.Flags().String("smtp-username", "", "SMTP username")
+	watchNodesCmd.Flags().String("email-from", "", "Sender address for email notifications")
+	watchNodesCmd.Flags().StringSlice("email-to", nil, "Recipient address for email notifications, may be repeated")
+	viper.BindPFlag("watch.interval", watchNodesCmd.Flags().Lookup("interval"))
+	viper.BindPFlag("watch.grace", watchNodesCmd.Flags().Lookup("grace"))
+	viper.BindPFlag("watch.webhook", watchNodesCmd.Flags().Lookup("webhook"))
+	viper.BindPFlag("watch.slack", watchNodesCmd.Flags().Lookup("slack"))
+	viper.BindPFlag("watch.email.smtp", watchNodesCmd.Flags().Lookup("smtp"))
+	viper.BindPFlag("watch.email.username", watchNodesCmd.Flags().Lookup("smtp-username"))
+	viper.BindPFlag("watch.email.from", watchNodesCmd.Flags().Lookup("email-from"))
+	viper.BindPFlag("watch.email.to", watchNodesCmd.Flags().Lookup("email-to"))
+
+	return watchNodesCmd
+}
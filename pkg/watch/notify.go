@@ -0,0 +1,93 @@
+package watch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Event describes a node that went online or offline.
+type Event struct {
+	Name   string    `json:"name"`
+	NodeSn string    `json:"node_sn"`
+	Online bool      `json:"online"`
+	Since  time.Time `json:"since"`
+}
+
+func (e Event) String() string {
+	state := "offline"
+	if e.Online {
+		state = "online"
+	}
+	return fmt.Sprintf("Wio node %s (%s) is %s since %s", e.Name, e.NodeSn, state, e.Since.Format(time.RFC3339))
+}
+
+// Notifier delivers node transition events.
+type Notifier interface {
+	Notify(Event) error
+}
+
+// Webhook posts the event as JSON to a generic webhook.
+type Webhook struct {
+	URL string
+}
+
+func (w Webhook) Notify(e Event) error {
+	return postJSON(w.URL, e)
+}
+
+// Slack posts the event to a Slack compatible incoming webhook.
+type Slack struct {
+	URL string
+}
+
+func (s Slack) Notify(e Event) error {
+	return postJSON(s.URL, map[string]string{"text": e.String()})
+}
+
+// Email sends the event through an SMTP server.
+type Email struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func (m Email) Notify(e Event) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", m.From, strings.Join(m.To, ", "), e.String(), e.String())
+	return smtp.SendMail(m.Addr, auth, m.From, m.To, []byte(msg))
+}
+
+func postJSON(url string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s failed: %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gabeduke/wio-cli-go/internal"
+	"github.com/gabeduke/wio-cli-go/pkg/nodes"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const stateFile = "watch-state.json"
+
+// nodeState is the last notified state of a node, persisted so a restart does not re-alert.
+type nodeState struct {
+	Name          string    `json:"name"`
+	Online        bool      `json:"online"`
+	Since         time.Time `json:"since"`
+	ChangingSince time.Time `json:"changing_since"`
+}
+
+type state map[string]*nodeState
+
+func statePath() (string, error) {
+	dir, err := internal.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, stateFile), nil
+}
+
+func loadState() (state, error) {
+	s := state{}
+	path, err := statePath()
+	if err != nil {
+		return s, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return s, err
+	}
+
+	err = json.Unmarshal(data, &s)
+	return s, err
+}
+
+func (s state) save() error {
+	path, err := statePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Watcher polls the node list and notifies online/offline transitions which last longer than Grace.
+type Watcher struct {
+	Interval  time.Duration
+	Grace     time.Duration
+	Notifiers []Notifier
+}
+
+// Run polls until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context, logger *log.Entry) error {
+	s, err := loadState()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		list, err := nodes.ListNodes(ctx)
+		if ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			logger.Error(err)
+		} else {
+			w.poll(logger, s, list.Nodes, time.Now())
+			if err := s.save(); err != nil {
+				logger.Error(err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) poll(logger *log.Entry, s state, list []nodes.Node, now time.Time) {
+	seen := map[string]bool{}
+	for _, n := range list {
+		seen[n.NodeSn] = true
+		st, ok := s[n.NodeSn]
+		if !ok {
+			s[n.NodeSn] = &nodeState{Name: n.Name, Online: n.Online, Since: now}
+			logger.WithField("sn", n.NodeSn).Infof("Watching %s, online: %t", n.Name, n.Online)
+			continue
+		}
+
+		st.Name = n.Name
+		if n.Online == st.Online {
+			st.ChangingSince = time.Time{}
+			continue
+		}
+
+		if st.ChangingSince.IsZero() {
+			st.ChangingSince = now
+		}
+		if now.Sub(st.ChangingSince) < w.Grace {
+			continue
+		}
+
+		// a node put to sleep is expected to be offline
+		if until, asleep := nodes.ExpectedAsleep(n); asleep && !n.Online {
+			logger.WithField("sn", n.NodeSn).Infof("%s is asleep until %s", n.Name, until.Format(time.RFC3339))
+			continue
+		}
+
+		event := Event{Name: n.Name, NodeSn: n.NodeSn, Online: n.Online, Since: st.ChangingSince}
+		if w.notify(logger, event) {
+			st.Online = n.Online
+			st.Since = st.ChangingSince
+			st.ChangingSince = time.Time{}
+		}
+	}
+
+	for sn := range s {
+		if !seen[sn] {
+			delete(s, sn)
+		}
+	}
+}
+
+// notify reports whether the event was delivered by at least one notifier, failed events are retried on the next poll.
+func (w *Watcher) notify(logger *log.Entry, e Event) bool {
+	logger.WithField("sn", e.NodeSn).Warn(e.String())
+	if len(w.Notifiers) == 0 {
+		return true
+	}
+
+	delivered := false
+	for _, n := range w.Notifiers {
+		if err := n.Notify(e); err != nil {
+			logger.WithField("sn", e.NodeSn).Error(err)
+			continue
+		}
+		delivered = true
+	}
+	return delivered
+}
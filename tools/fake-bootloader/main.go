@@ -0,0 +1,83 @@
+// fake-bootloader emulates the serial bootloader of an ESP8266 on a pseudo-terminal, to develop and try
+// wio device flash without a board:
+//
+//	go run ./tools/fake-bootloader -flash /tmp/flash.bin
+//	wio device flash --port <printed pty> firmware.bin
+//
+// The content of the emulated flash is saved to the -flash file after each write. With -firmware, the lines
+// of a file are printed after each reset, like the serial output of the firmware, to try wio device monitor:
+//
+//	go run ./tools/fake-bootloader -boot -firmware pkg/device/testdata/wrong-password.log
+//	wio device monitor --port <printed pty>
+//
+// The emulator itself is the esptest package, also used by the tests of pkg/esp and pkg/device.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/gabeduke/wio-cli-go/pkg/esp/esptest"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+	var size int
+	var path, link, firmware string
+	var boot, noSync, corrupt bool
+	var failBlock int
+	var lineDelay time.Duration
+	flag.StringVar(&path, "flash", "", "save the emulated flash to this file after each write")
+	flag.IntVar(&size, "size", 1<<20, "size of the emulated flash in bytes")
+	flag.StringVar(&link, "link", "", "symlink to the pty, eg. /tmp/ttyESP")
+	flag.BoolVar(&noSync, "no-sync", false, "never answer SYNC, like a board not in bootloader mode")
+	flag.BoolVar(&corrupt, "corrupt", false, "flip a bit of each write, to fail the MD5 verification")
+	flag.IntVar(&failBlock, "fail-block", 0, "answer a flash write error to the n-th data block")
+	flag.StringVar(&firmware, "firmware", "", "print the lines of this file after each reset, like the firmware")
+	flag.DurationVar(&lineDelay, "line-delay", 100*time.Millisecond, "wait between the lines of -firmware")
+	flag.BoolVar(&boot, "boot", false, "start by running the firmware rather than in the bootloader")
+	flag.Parse()
+
+	b := esptest.New(size)
+	b.NoSync, b.Corrupt, b.FailBlock, b.LineDelay = noSync, corrupt, failBlock, lineDelay
+	b.Logf = log.Printf
+	if path != "" {
+		b.OnWrite = func(flash []byte) {
+			if err := os.WriteFile(path, flash, 0644); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+	if firmware != "" {
+		data, err := os.ReadFile(firmware)
+		if err != nil {
+			log.Fatal(err)
+		}
+		b.Firmware = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+
+	// keep the slave open so that the master does not fail between two connections
+	master, slave, err := esptest.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer slave.Close()
+
+	if link != "" {
+		os.Remove(link)
+		if err := os.Symlink(slave.Name(), link); err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(link)
+	}
+	fmt.Println(slave.Name())
+
+	if boot {
+		b.Boot(master)
+	}
+	if err := b.Serve(master); err != nil {
+		log.Print(err)
+	}
+}